@@ -1,71 +1,209 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"time"
 
-	"github.com/asgaut/dumpils/pkg/demod"
-	"github.com/bemasher/rtltcp"
+	"github.com/asgaut/dumpils/pkg/channels"
+	_ "github.com/asgaut/dumpils/pkg/demod"
+	_ "github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/source"
 )
 
-func main() {
-	var sdr rtltcp.SDR
+// channelFrequency returns the localizer or glide path frequency in Hz of an
+// ILS channel name, or the frequency of 'channel' given in MHz
+func channelFrequency(channel string, gp bool) (float64, error) {
+	if c, ok := channels.Lookup(channel); ok {
+		if c.LOC == 0 {
+			return 0, fmt.Errorf("channel %s is a VOR channel", c.Name)
+		}
+		if gp {
+			return c.GP * 1e6, nil
+		}
+		return c.LOC * 1e6, nil
+	}
+	f, err := strconv.ParseFloat(channel, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("'%s' is neither an ILS channel name nor a frequency in MHz", channel)
+	}
+	if c, ok := channels.ByFrequency(f); !ok || c.LOC == 0 {
+		log.Printf("Warning: %g MHz is not an ILS channel frequency", f)
+	}
+	return f * 1e6, nil
+}
 
-	sdr.HandleFlags()
+// options holds the command line arguments
+type options struct {
+	server, input, sampleFormat string
+	channel                     string
+	gp, agc                     bool
+	gain                        float64
+	ppm                         int
+	algorithm                   string
+	cfg                         ils.Config
+	interval                    time.Duration
 
-	// Connect to rtl_tcp server.
-	if err := sdr.Connect(nil); err != nil {
-		log.Fatal(err)
-	}
-	defer sdr.Close()
+	recordDir  string
+	recordSize int64
+	recordTime time.Duration
+}
 
-	f := 110.1e6
-	channelOffset := 200.0e3
-	fs := 10.0 * float64(1<<17) // 1310720.0 Hz
+func main() {
+	var o options
+	flag.StringVar(&o.server, "server", "127.0.0.1:1234", "address and port of rtl_tcp, or a source URI such as rtltcp://host:port or sim://")
+	flag.StringVar(&o.input, "in", "", "IQ file (raw, WAV or SigMF) or file:// URI to process once instead of -server")
+	flag.StringVar(&o.sampleFormat, "format", "", fmt.Sprintf("sample format %v of a raw -in file (default from the file extension, else cu8)", iq.Formats()))
+	flag.StringVar(&o.channel, "channel", "38X", "ILS channel name, e.g. 38X, or frequency in MHz, e.g. 110.1")
+	flag.BoolVar(&o.gp, "gp", false, "receive the glide path of the ILS channel instead of the localizer")
+	flag.Float64Var(&o.gain, "gain", 40, "tuner gain in dB")
+	flag.BoolVar(&o.agc, "agc", false, "use automatic tuner gain instead of -gain")
+	flag.IntVar(&o.ppm, "ppm", 0, "frequency correction of the dongle in ppm")
+	flag.StringVar(&o.algorithm, "algorithm", "demod2", fmt.Sprintf("demodulation algorithm %v", ils.Algorithms()))
+	flag.Float64Var(&o.cfg.SampleRate, "rate", 10.0*float64(1<<17), "sample rate in Hz, e.g. 1024000, 2048000 or 2400000")
+	flag.Float64Var(&o.cfg.Offset, "offset", 200.0e3, "channel frequency relative to the tuned center frequency in Hz (offset tuning)")
+	flag.DurationVar(&o.cfg.Integration, "integration", ils.DefaultIntegration, "integration period of the measurements")
+	flag.Float64Var(&o.cfg.Overlap, "overlap", 0, "fraction of the integration period shared by successive measurements (0 <= overlap < 1)")
+	flag.BoolVar(&o.cfg.AFC, "afc", false, "retune the channel filter to follow the carrier frequency (demod2 only)")
+	flag.DurationVar(&o.interval, "interval", 0, "time between printed measurements (0 prints every measurement)")
+	flag.StringVar(&o.recordDir, "record", "", "directory to record the IQ samples from rtl_tcp to (disabled if empty)")
+	flag.Int64Var(&o.recordSize, "recsize", 1<<30, "maximum size of a recorded IQ file in bytes (0 for no limit)")
+	flag.DurationVar(&o.recordTime, "rectime", 10*time.Minute, "maximum duration of a recorded IQ file (0 for no limit)")
+	flag.Parse()
 
-	sdr.SetCenterFreq(uint32(f - channelOffset)) // offset tuning
-	sdr.SetSampleRate(uint32(fs))
-	sdr.SetGain(400) // 40 dB
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Kill, os.Interrupt)
+	if err := run(o, os.Stdout, sigint); err != nil {
+		log.Fatal(err)
+	}
+	if o.input == "" {
+		fmt.Printf("Exiting on Ctrl-C.")
+	}
+}
 
-	in, out := io.Pipe()
+// run prints the measurements to 'w' until the end of the input file or a
+// signal on 'stop'. The recorded file is complete when run returns, also on errors.
+func run(o options, w io.Writer, stop <-chan os.Signal) (err error) {
+	f, err := channelFrequency(o.channel, o.gp)
+	if err != nil {
+		return err
+	}
+	cfg := o.cfg
+	uri := o.server
+	opts := source.Options{SampleRate: cfg.SampleRate, Center: f - cfg.Offset, Gain: o.gain, AGC: o.agc, PPM: o.ppm, Format: o.sampleFormat}
+	if o.input != "" {
+		uri = o.input
+		opts.Once = true
+	}
+	src, err := source.Open(uri, opts)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// A signal closes the source, which ends a Read blocked while rtl_tcp reconnects
+	stopped, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
 	go func() {
-		for {
-			io.CopyN(out, sdr, 16384)
+		select {
+		case <-stop:
+			close(stopped)
+			src.Close()
+		case <-done:
 		}
 	}()
+	// A recording overrides -rate and -offset if it describes them
+	meta := src.Metadata()
+	format, err := iq.LookupFormat(meta.Format)
+	if err != nil {
+		return err
+	}
+	cfg.SampleRate = meta.SampleRate
+	if meta.CenterFrequency != 0 {
+		cfg.Offset = f - meta.CenterFrequency
+	}
+	demodulator, err := ils.New(o.algorithm, cfg)
+	if err != nil {
+		return err
+	}
 
-	iqRawData := make([]byte, int(fs/10)<<1)
-
-	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, os.Kill, os.Interrupt)
+	var recorder *iq.Recorder
+	if _, live := src.(*source.RTLTCP); live && o.recordDir != "" {
+		prefix := "loc"
+		if f > 200e6 {
+			prefix = "gp"
+		}
+		recorder = iq.NewRecorder(o.recordDir, prefix, o.recordSize, o.recordTime, meta)
+		defer func() {
+			if cerr := recorder.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
 
-	demodulator := demod.NewDemodulator(channelOffset, int(fs/10))
+	iqRawData := make([]byte, cfg.BlockSize()*format.Size)
+	iqSamples := make([]complex64, cfg.BlockSize())
 
-	fmt.Printf("RF(dbFS);DDM(uA);SDM(%%);Ident\n")
+	if o.input == "" {
+		log.Printf("Receiving %.3f MHz", f/1e6)
+	}
+	fmt.Fprintf(w, "Time(s);RF(dbFS);DDM(uA);SDM(%%);Ident;Morse;Offset(Hz);Phase(deg);F90(Hz);F150(Hz);THD90(%%);THD150(%%)\n")
 
-Loop:
+	var elapsed, next time.Duration
+	var blocks int64
+	var ident string
 	for {
+		err := src.Read(iqRawData)
 		select {
-		case <-sigint:
-			break Loop
+		case <-stopped:
+			return nil
 		default:
-			_, err := io.ReadFull(in, iqRawData)
-			if err != nil {
-				log.Fatal("Error reading samples:", err)
-			}
-			p, d, s, i := demodulator.Process(iqRawData)
-			// Convert DDM in % to µA
-			if f > 200e6 {
-				d *= 150 / 17.5
-			} else {
-				d *= 150 / 15.5
+		}
+		if o.input != "" && err == io.EOF {
+			return nil // a partial block at the end of the file is not processed
+		}
+		if err != nil {
+			return fmt.Errorf("error reading samples: %v", err)
+		}
+		if recorder != nil {
+			if _, err := recorder.Write(iqRawData); err != nil {
+				return fmt.Errorf("error recording samples: %v", err)
 			}
-			fmt.Printf("%.1f;%.3f;%.3f;%.3f\n", p, d, s, i)
+		}
+		format.Decode(iqSamples, iqRawData)
+		m, err := demodulator.Process(iqSamples)
+		if err != nil {
+			return fmt.Errorf("error demodulating samples: %v", err)
+		}
+		if recorder != nil && m.Ident.Text != "" && m.Ident.Text != ident {
+			recorder.Annotate("ident", m.Ident.Text, int64(len(iqSamples)))
+		}
+		ident = m.Ident.Text
+		blocks++
+		elapsed = time.Duration(float64(blocks*int64(cfg.BlockSize())) / cfg.SampleRate * float64(time.Second))
+		if elapsed < next {
+			continue
+		}
+		next += o.interval
+		// Convert DDM in % to µA. The glide path frequencies are above 200 MHz.
+		d := float64(m.DDM)
+		if f > 200e6 {
+			d *= 150 / 17.5
+		} else {
+			d *= 150 / 15.5
+		}
+		// The time of the end of the block from the start of the input
+		fmt.Fprintf(w, "%.3f;%.1f;%.3f;%.3f;%.3f;%s;", elapsed.Seconds(), m.RF, d, m.SDM, m.Ident.Depth, m.Ident.Text)
+		if o.algorithm == "demod" {
+			fmt.Fprintf(w, ";;;;;\n") // demod measures neither the carrier offset nor the tones
+		} else {
+			fmt.Fprintf(w, "%.1f;%.1f;%.2f;%.2f;%.2f;%.2f\n", m.Offset, m.Phase, m.Freq90, m.Freq150, m.THD90, m.THD150)
 		}
 	}
-
-	fmt.Printf("Exiting on Ctrl-C.")
 }
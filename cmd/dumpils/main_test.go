@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/rtlserver"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+func TestChannelFrequency(t *testing.T) {
+	tests := []struct {
+		channel string
+		gp      bool
+		f       float64
+	}{
+		{"38X", false, 110.1e6},
+		{"38x", true, 334.4e6},
+		{"18Y", false, 108.15e6},
+		{"109.9", false, 109.9e6},
+		{"75", false, 75e6},
+	}
+	for _, tc := range tests {
+		f, err := channelFrequency(tc.channel, tc.gp)
+		if err != nil || f != tc.f {
+			t.Errorf("%s: %.0f Hz %v, want %.0f Hz", tc.channel, f, err, tc.f)
+		}
+	}
+	for _, channel := range []string{"17X", "abc", "-1"} {
+		if _, err := channelFrequency(channel, false); err == nil {
+			t.Errorf("%s: no error", channel)
+		}
+	}
+}
+
+// output is the output of run, safe to read while run is writing
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// TestRun prints the measurements of a localizer received from an rtl_tcp
+// server and records the samples
+func TestRun(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3, Integration: ils.DefaultIntegration}
+	sim := source.NewSim(source.Options{SampleRate: cfg.SampleRate})
+	// The ident E is repeated to be decoded within a few seconds
+	g, err := siggen.New(cfg.SampleRate, cfg.Offset, siggen.Params{Carrier: siggen.Carrier{DDM: 10, SDM: 40, RF: -6},
+		Ident: strings.Repeat("E ", 10), IdentDepth: 10, WPM: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetGenerator(g)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rtlserver.New(sim)
+	go server.Serve(l)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dumpils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := options{server: "rtltcp://" + l.Addr().String(), channel: "38X", gain: 40, algorithm: "demod2", cfg: cfg, recordDir: dir}
+	var out output
+	stop := make(chan os.Signal, 1)
+	done := make(chan error)
+	go func() {
+		done <- run(o, &out, stop)
+	}()
+	// Stop when the ident is decoded
+	for start := time.Now(); !strings.Contains(out.String(), ";E;") && time.Since(start) < 20*time.Second; {
+		time.Sleep(100 * time.Millisecond)
+	}
+	stop <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if f := server.Settings().CenterFreq; f != 109900000 {
+		t.Errorf("center frequency %d Hz, want 109900000 Hz", f)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 10 || !strings.HasPrefix(lines[0], "Time(s);RF(dbFS);DDM(uA)") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	columns := strings.Split(lines[len(lines)-1], ";")
+	ddm, _ := strconv.ParseFloat(columns[2], 64)
+	if len(columns) != 12 || math.Abs(ddm-10*150/15.5) > 2 || columns[5] != "E" {
+		t.Errorf("last line %s, want a DDM of 96.8 uA and the ident E", lines[len(lines)-1])
+	}
+
+	// The recording holds the samples of every printed block and the ident annotation
+	files, _ := filepath.Glob(filepath.Join(dir, "loc_*_109900000Hz"+iq.SigMFDataExt))
+	if len(files) != 1 {
+		t.Fatalf("recorded %v, want one file", files)
+	}
+	if fi, err := os.Stat(files[0]); err != nil || fi.Size() != int64((len(lines)-1)*cfg.BlockSize()*2) {
+		t.Errorf("recorded %v %v, want %d blocks", fi, err, len(lines)-1)
+	}
+	_, meta := iq.SigMFFiles(files[0])
+	s, err := iq.ReadSigMF(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Annotations) == 0 || s.Annotations[0].Label != "ident" || s.Annotations[0].Comment != "E" {
+		t.Errorf("annotations %+v, want the ident", s.Annotations)
+	}
+}
+
+// TestStopReconnecting stops dumpils while the rtl_tcp server is down
+func TestStopReconnecting(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3, Integration: ils.DefaultIntegration}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rtlserver.New(source.NewSim(source.Options{SampleRate: cfg.SampleRate}))
+	go server.Serve(l)
+
+	o := options{server: "rtltcp://" + l.Addr().String(), channel: "38X", gain: 40, algorithm: "demod2", cfg: cfg}
+	var out output
+	stop := make(chan os.Signal, 1)
+	done := make(chan error)
+	go func() {
+		done <- run(o, &out, stop)
+	}()
+	for start := time.Now(); strings.Count(out.String(), "\n") < 2 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.Close()
+	time.Sleep(100 * time.Millisecond)
+	stop <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dumpils not stopped while reconnecting")
+	}
+}
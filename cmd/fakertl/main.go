@@ -0,0 +1,68 @@
+// fakertl is an rtl_tcp server for demonstrations and tests without a dongle.
+// It streams a synthetic localizer signal or a recorded IQ file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/asgaut/dumpils/pkg/rtlserver"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+func main() {
+	var listen, input string
+	var rate, offset float64
+	loc := siggen.Localizer()
+	flag.StringVar(&listen, "listen", "127.0.0.1:1234", "address and port to listen on")
+	flag.StringVar(&input, "in", "", "IQ file (raw, WAV or SigMF) or source URI to stream instead of the synthetic localizer")
+	flag.Float64Var(&rate, "rate", 10.0*float64(1<<17), "sample rate in Hz of the synthetic signal and raw IQ files")
+	flag.Float64Var(&offset, "offset", 200.0e3, "frequency of the synthetic carrier relative to the tuned center frequency in Hz")
+	flag.Float64Var(&loc.DDM, "ddm", loc.DDM, "DDM of the synthetic signal in %")
+	flag.Float64Var(&loc.SDM, "sdm", loc.SDM, "SDM of the synthetic signal in %")
+	flag.Float64Var(&loc.RF, "rf", loc.RF, "carrier level of the synthetic signal in dBFS")
+	flag.StringVar(&loc.Ident, "ident", "", "identifier keyed in Morse code on the synthetic signal")
+	flag.Float64Var(&loc.Noise, "noise", 0, "noise level of the synthetic signal in dBFS (0 for no noise)")
+	flag.Parse()
+
+	var src source.SampleSource
+	if input == "" {
+		g, err := siggen.New(rate, offset, loc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sim := source.NewSim(source.Options{SampleRate: rate})
+		sim.SetGenerator(g)
+		src = sim
+	} else {
+		var err error
+		src, err = source.Open(input, source.Options{SampleRate: rate})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer src.Close()
+
+	s := rtlserver.New(src)
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt)
+	stopped := make(chan struct{})
+	go func() {
+		<-sigint
+		close(stopped)
+		s.Close()
+	}()
+	meta := src.Metadata()
+	fmt.Printf("Serving %s samples at %.0f S/s on %s. Press Ctrl-C to exit.\n", meta.Format, meta.SampleRate, listen)
+	if err := s.ListenAndServe(listen); err != nil {
+		select {
+		case <-stopped:
+		default:
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/monitor"
+)
+
+// alarmState is the alarm monitor of a source served at /alarms
+type alarmState struct {
+	Rules  []monitor.Rule  `json:"rules"`
+	States []monitor.State `json:"states"`
+	Events []monitor.Event `json:"events"` // Last state changes, the oldest first
+}
+
+// setupAlarms creates the alarm monitor of each processor with the default
+// rules of the localizer and the glide path, or with the rules of the
+// sources in the JSON file 'name' if not empty. The default rules of the
+// localizer check the ident depth if it keys the identifier 'ident'.
+func setupAlarms(name, ident string, processors map[string]*processor) error {
+	rules := map[string][]monitor.Rule{"loc": monitor.Localizer(), "gp": monitor.GlidePath()}
+	if ident != "" {
+		rules["loc"] = append(rules["loc"], monitor.Ident())
+	}
+	if name != "" {
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var file map[string][]monitor.Rule
+		if err := json.Unmarshal(buf, &file); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		for source, r := range file {
+			if _, ok := processors[source]; !ok {
+				return fmt.Errorf("%s: '%s' input not defined", name, source)
+			}
+			rules[source] = r
+		}
+	}
+	for source, p := range processors {
+		m, err := monitor.New(source, rules[source])
+		if err != nil {
+			return fmt.Errorf("alarm rules of '%s': %v", source, err)
+		}
+		p.monitor = m
+	}
+	return nil
+}
+
+// checkAlarms checks the measurements of the last block against the alarm
+// rules and logs the state changes. The caller must hold the mutex.
+func (p *processor) checkAlarms() {
+	p.alarms = nil
+	if p.monitor == nil {
+		return
+	}
+	p.alarms = p.monitor.Check(p.time, &p.meas.Meas)
+	for _, e := range p.alarms {
+		log.Printf("Alarm monitor: %v", e)
+	}
+}
+
+// checkLost checks the alarm rules at time 'now' while the source delivers no
+// samples and logs the state changes. The caller must hold the mutex.
+func (p *processor) checkLost(now time.Time) {
+	p.alarms = nil
+	if p.monitor == nil {
+		return
+	}
+	p.alarms = p.monitor.Lost(now)
+	for _, e := range p.alarms {
+		log.Printf("Alarm monitor: %v", e)
+	}
+}
+
+// alarmState returns the state of the alarm monitor. The caller must hold the mutex.
+func (p *processor) alarmState() alarmState {
+	if p.monitor == nil {
+		return alarmState{Rules: []monitor.Rule{}, States: []monitor.State{}, Events: []monitor.Event{}}
+	}
+	return alarmState{Rules: p.monitor.Rules(), States: p.monitor.States(), Events: p.monitor.Events()}
+}
+
+// alarms returns the rules, states and last state changes of the alarm monitor
+// of each source, or of the source given by the 'source' argument.
+// PUT replaces the rules of a source, which returns all rules to normal.
+func alarms(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if r.Method == http.MethodOptions {
+			return
+		}
+		names := []string{}
+		if source, ok := r.URL.Query()["source"]; ok {
+			if len(source) != 1 {
+				http.Error(w, "'source' argument missing", http.StatusBadRequest)
+				return
+			}
+			if _, ok := s.processors[source[0]]; !ok {
+				http.Error(w, fmt.Sprintf("'%s' input not defined", source[0]), http.StatusBadRequest)
+				return
+			}
+			names = source
+		} else if r.Method == http.MethodPut {
+			http.Error(w, "'source' argument missing", http.StatusBadRequest)
+			return
+		} else {
+			for name := range s.processors {
+				names = append(names, name)
+			}
+		}
+
+		if r.Method == http.MethodPut {
+			var rules []monitor.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			m, err := monitor.New(names[0], rules)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			p := s.processors[names[0]]
+			p.mu.Lock()
+			p.monitor = m
+			p.mu.Unlock()
+			log.Printf("Alarm monitor: new rules of '%s'", names[0])
+		}
+
+		resp := map[string]alarmState{}
+		for _, name := range names {
+			p := s.processors[name]
+			p.mu.Lock()
+			resp[name] = p.alarmState()
+			p.mu.Unlock()
+		}
+		buf, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+}
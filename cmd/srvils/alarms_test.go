@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/monitor"
+)
+
+func TestAlarms(t *testing.T) {
+	s := &httpapi{processors: map[string]*processor{"loc": {}, "gp": {}, "vor": {}}}
+	if err := setupAlarms("", "TST", s.processors); err != nil {
+		t.Fatal(err)
+	}
+	// The DDM of the localizer is out of tolerance for 10 s
+	p := s.processors["loc"]
+	start := time.Now()
+	for i := 0; i <= 100; i++ {
+		p.meas.Meas = ils.Meas{DDM: 2, SDM: 40, RF: -6}
+		p.meas.Ident.Depth = 10
+		p.time = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		p.checkAlarms()
+	}
+	if u := p.update(); !reflect.DeepEqual(u.Alarms, []string{"ddm"}) {
+		t.Errorf("alarms %v in the update, want [ddm]", u.Alarms)
+	}
+
+	do := func(method, query, body string) (map[string]alarmState, int) {
+		w := httptest.NewRecorder()
+		alarms(s).ServeHTTP(w, httptest.NewRequest(method, "/alarms"+query, strings.NewReader(body)))
+		var resp map[string]alarmState
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, w.Code
+	}
+	resp, code := do(http.MethodGet, "", "")
+	if code != http.StatusOK || len(resp) != 3 || len(resp["gp"].Rules) != 3 || len(resp["vor"].Rules) != 0 {
+		t.Fatalf("status %d, %+v", code, resp)
+	}
+	loc := resp["loc"]
+	if len(loc.Events) != 1 || loc.Events[0].Rule != "ddm" || loc.Events[0].State != monitor.Alarm ||
+		loc.States[0].State != monitor.Alarm || loc.States[1].State != monitor.Normal {
+		t.Errorf("localizer %+v", loc)
+	}
+
+	resp, code = do(http.MethodPut, "?source=loc", `[{"field":"ddm","min":-3,"max":3,"persistence":1}]`)
+	if code != http.StatusOK || len(resp) != 1 || len(resp["loc"].Rules) != 1 || resp["loc"].States[0].State != monitor.Normal {
+		t.Errorf("status %d, %+v", code, resp)
+	}
+	for _, c := range []struct{ method, query, body string }{
+		{http.MethodGet, "?source=mkr", ""},
+		{http.MethodPut, "", "[]"},
+		{http.MethodPut, "?source=loc", `{"field":"ddm"}`},
+		{http.MethodPut, "?source=loc", `[{"field":"bearing","max":3}]`},
+	} {
+		if _, code := do(c.method, c.query, c.body); code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: status %d, want 400", c.method, c.query, c.body, code)
+		}
+	}
+}
+
+func TestSetupAlarms(t *testing.T) {
+	f, err := ioutil.TempFile("", "alarms*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"gp": [], "vor": [{"field": "rf", "min": -40}]}`)
+	f.Close()
+
+	processors := map[string]*processor{"loc": {}, "gp": {}, "vor": {}}
+	if err := setupAlarms(f.Name(), "", processors); err != nil {
+		t.Fatal(err)
+	}
+	if len(processors["loc"].monitor.Rules()) != 3 || len(processors["gp"].monitor.Rules()) != 0 ||
+		processors["vor"].monitor.Rules()[0].Name != "rf" {
+		t.Errorf("rules %+v %+v %+v", processors["loc"].monitor.Rules(), processors["gp"].monitor.Rules(), processors["vor"].monitor.Rules())
+	}
+	if err := setupAlarms(f.Name(), "", map[string]*processor{"loc": {}, "gp": {}}); err == nil {
+		t.Error("no error for the rules of an undefined source")
+	}
+}
+
+func TestCheckLost(t *testing.T) {
+	p := &processor{}
+	if err := setupAlarms("", "TST", map[string]*processor{"loc": p}); err != nil {
+		t.Fatal(err)
+	}
+	// The source delivers no samples for 10 s
+	start := time.Now()
+	for i := 0; i <= 10; i++ {
+		p.checkLost(start.Add(time.Duration(i) * time.Second))
+	}
+	if u := p.update(); !reflect.DeepEqual(u.Alarms, []string{"ddm", "sdm", "rf", "ident"}) || u.Meas.Status != "stopped" {
+		t.Errorf("alarms %v with the source %s, want all alarms with the source stopped", u.Alarms, u.Meas.Status)
+	}
+}
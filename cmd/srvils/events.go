@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/monitor"
+)
+
+// eventBuffer is the number of updates buffered for each client of /events.
+// Updates are dropped for clients which do not keep up.
+const eventBuffer = 16
+
+// update is the measurements of one block pushed to the clients of /events
+type update struct {
+	Seq       uint64          `json:"seq"`   // Sequence number of the updates of all sources
+	Block     uint64          `json:"block"` // Number of blocks processed by the source, a gap means dropped updates
+	Source    string          `json:"source"`
+	Time      time.Time       `json:"time"` // When the block was processed
+	Meas      measurements    `json:"meas"`
+	Alarms    []string        `json:"alarms,omitempty"`    // Alarm rules in the alarm state
+	Changes   []monitor.Event `json:"changes,omitempty"`   // State changes of the alarm rules in this block
+	Spectrum1 []float32       `json:"spectrum1,omitempty"` // Amplitude spectrum of the input signal if requested
+	Spectrum2 []float32       `json:"spectrum2,omitempty"` // Amplitude spectrum of the AM signal if requested
+}
+
+// subscriber is a client of the broadcaster
+type subscriber struct {
+	updates chan update
+	spectra bool            // send the spectra
+	sources map[string]bool // sources sent, all if empty
+}
+
+// broadcaster distributes the updates of the processors to the clients of /events
+type broadcaster struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*subscriber]bool
+	closed      bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subscribers: map[*subscriber]bool{}}
+}
+
+// subscribe adds a client receiving the updates of 'sources', or all sources if empty.
+// The updates channel is closed when the broadcaster is closed.
+func (b *broadcaster) subscribe(sources []string, spectra bool) *subscriber {
+	s := &subscriber{updates: make(chan update, eventBuffer), spectra: spectra, sources: map[string]bool{}}
+	for _, name := range sources {
+		s.sources[name] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.updates)
+	} else {
+		b.subscribers[s] = true
+	}
+	return s
+}
+
+// unsubscribe removes a client
+func (b *broadcaster) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.updates)
+	}
+}
+
+// wantSpectra returns true if a client of 'source' receives the spectra
+func (b *broadcaster) wantSpectra(source string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		if s.spectra && (len(s.sources) == 0 || s.sources[source]) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish numbers the update and sends it to the clients without blocking
+func (b *broadcaster) publish(u update) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	u.Seq = b.seq
+	for s := range b.subscribers {
+		if len(s.sources) != 0 && !s.sources[u.Source] {
+			continue
+		}
+		v := u
+		if !s.spectra {
+			v.Spectrum1, v.Spectrum2 = nil, nil
+		}
+		select {
+		case s.updates <- v:
+		default:
+		}
+	}
+}
+
+// close ends the streams of all clients
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		close(s.updates)
+	}
+	b.subscribers = map[*subscriber]bool{}
+}
+
+// decimate returns the maximum of each group of bins of 'spectrum' in at most 'n' bins
+func decimate(spectrum []float32, n int) []float32 {
+	if n <= 0 || len(spectrum) <= n {
+		return spectrum
+	}
+	group := (len(spectrum) + n - 1) / n
+	out := make([]float32, 0, n)
+	for i := 0; i < len(spectrum); i += group {
+		end := i + group
+		if end > len(spectrum) {
+			end = len(spectrum)
+		}
+		max := spectrum[i]
+		for _, v := range spectrum[i+1 : end] {
+			if v > max {
+				max = v
+			}
+		}
+		out = append(out, max)
+	}
+	return out
+}
+
+// events streams the measurements of each block as Server-Sent Events.
+// The optional 'source' arguments select the sources and 'spectrum' adds the
+// spectra decimated to that number of bins.
+func events(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		sources := r.URL.Query()["source"]
+		for _, name := range sources {
+			if _, ok := s.processors[name]; !ok {
+				http.Error(w, fmt.Sprintf("'%s' input not defined", name), http.StatusBadRequest)
+				return
+			}
+		}
+		var bins int
+		if v := r.URL.Query().Get("spectrum"); v != "" {
+			var err error
+			if bins, err = strconv.Atoi(v); err != nil || bins < 1 {
+				http.Error(w, fmt.Sprintf("invalid number of spectrum bins '%s'", v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		sub := s.events.subscribe(sources, bins > 0)
+		defer s.events.unsubscribe(sub)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case u, ok := <-sub.updates:
+				if !ok {
+					return
+				}
+				u.Spectrum1 = decimate(u.Spectrum1, bins)
+				u.Spectrum2 = decimate(u.Spectrum2, bins)
+				buf, err := json.Marshal(u)
+				if err != nil {
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+				} else if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", u.Seq, buf); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+func TestDecimate(t *testing.T) {
+	s := []float32{1, 5, 2, 2, 7, 3, 0}
+	if got := decimate(s, 3); !reflect.DeepEqual(got, []float32{5, 7, 0}) {
+		t.Errorf("decimated to %v, want [5 7 0]", got)
+	}
+	if got := decimate(s, 10); len(got) != len(s) {
+		t.Errorf("decimated to %v, want %v", got, s)
+	}
+}
+
+// TestEvents receives the measurements of a simulator source from /events
+func TestEvents(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3, Integration: ils.DefaultIntegration}
+	signal := siggen.Localizer()
+	signal.DDM = 5
+	b := newBroadcaster()
+	p := &processor{name: "loc", algorithm: "demod2", cfg: cfg, signal: &signal, events: b}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx, "sim://", source.Options{})
+	s := &httpapi{processors: map[string]*processor{"loc": p, "gp": {}}, events: b}
+	server := httptest.NewServer(events(s))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/events?source=vor"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v %v for an unknown source, want status 400", resp, err)
+	}
+	resp, err := http.Get(server.URL + "/events?source=loc&spectrum=64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %s", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	var last update
+	for i := 0; i < 5; i++ {
+		var id string
+		var u update
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			if strings.HasPrefix(line, "id: ") {
+				id = line[4:]
+			} else if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &u); err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+		}
+		if id != strconv.FormatUint(u.Seq, 10) || u.Source != "loc" || time.Since(u.Time) > time.Second ||
+			len(u.Spectrum1) != 64 || len(u.Spectrum2) != 64 {
+			t.Errorf("id %s, update %d of %s at %v with %d/%d spectrum bins", id, u.Seq, u.Source, u.Time, len(u.Spectrum1), len(u.Spectrum2))
+		}
+		if i > 0 && (u.Seq != last.Seq+1 || u.Block != last.Block+1) {
+			t.Errorf("update %d of block %d after %d of block %d", u.Seq, u.Block, last.Seq, last.Block)
+		}
+		last = u
+	}
+	if math.Abs(float64(last.Meas.DDM)-5) > 0.2 || last.Meas.Status != source.StatusOK {
+		t.Errorf("DDM %.2f%%, status %s, want 5%% and ok", last.Meas.DDM, last.Meas.Status)
+	}
+
+	// The stream ends when the server shuts down
+	b.close()
+	for {
+		if _, err := r.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// maxHistoryPoints limits the number of steps returned by /history
+const maxHistoryPoints = 10000
+
+// historyFields are the measurements kept in the history
+var historyFields = []struct {
+	name  string
+	value func(m *ils.Meas) float32
+}{
+	{"ddm", func(m *ils.Meas) float32 { return m.DDM }},
+	{"sdm", func(m *ils.Meas) float32 { return m.SDM }},
+	{"rf", func(m *ils.Meas) float32 { return m.RF }},
+	{"mod90", func(m *ils.Meas) float32 { return m.Mod90 }},
+	{"mod150", func(m *ils.Meas) float32 { return m.Mod150 }},
+	{"offset", func(m *ils.Meas) float32 { return m.Offset }},
+	{"phase", func(m *ils.Meas) float32 { return m.Phase }},
+	{"ident", func(m *ils.Meas) float32 { return m.Ident.Depth }},
+}
+
+// historyRecord is the measurements of one block
+type historyRecord struct {
+	time   int64 // Unix time in nanoseconds
+	values []float32
+}
+
+// historyBuffer is a ring buffer of the measurements of the latest blocks
+type historyBuffer struct {
+	mu      sync.Mutex
+	records []historyRecord
+	next    int  // index of the next record written
+	full    bool // all records are written
+}
+
+// newHistory creates a history of the last 'n' blocks
+func newHistory(n int) *historyBuffer {
+	h := &historyBuffer{records: make([]historyRecord, n)}
+	for i := range h.records {
+		h.records[i].values = make([]float32, len(historyFields))
+	}
+	return h
+}
+
+// add adds the measurements 'm' made at time 't', replacing the oldest if the history is full
+func (h *historyBuffer) add(t time.Time, m *ils.Meas) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := &h.records[h.next]
+	r.time = t.UnixNano()
+	for i, f := range historyFields {
+		r.values[i] = f.value(m)
+	}
+	h.next++
+	if h.next == len(h.records) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// series holds the aggregates of a measurement in each step
+type series struct {
+	Min  []float32 `json:"min"`
+	Mean []float32 `json:"mean"`
+	Max  []float32 `json:"max"`
+}
+
+// historyResponse is the response of /history. Steps without measurements are left out.
+type historyResponse struct {
+	Source string            `json:"source"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Step   float64           `json:"step"`  // Length of the steps in seconds
+	Time   []time.Time       `json:"time"`  // Start of each step
+	Count  []int             `json:"count"` // Number of blocks in each step
+	Values map[string]series `json:"values"`
+}
+
+// aggregate returns the minimum, mean and maximum of the measurements from
+// 'from' until 'to' in steps of 'step'
+func (h *historyBuffer) aggregate(from, to time.Time, step time.Duration) historyResponse {
+	resp := historyResponse{From: from, To: to, Step: step.Seconds(), Time: []time.Time{}, Count: []int{}, Values: map[string]series{}}
+	for _, f := range historyFields {
+		resp.Values[f.name] = series{Min: []float32{}, Mean: []float32{}, Max: []float32{}}
+	}
+	n := len(historyFields)
+	min := make([]float32, n)
+	max := make([]float32, n)
+	sum := make([]float64, n)
+	count := 0
+	bucket := int64(-1)
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		resp.Time = append(resp.Time, from.Add(time.Duration(bucket)*step))
+		resp.Count = append(resp.Count, count)
+		for i, f := range historyFields {
+			s := resp.Values[f.name]
+			s.Min = append(s.Min, min[i])
+			s.Mean = append(s.Mean, float32(sum[i]/float64(count)))
+			s.Max = append(s.Max, max[i])
+			resp.Values[f.name] = s
+		}
+		count = 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start, end := 0, h.next
+	if h.full {
+		start, end = h.next, h.next+len(h.records)
+	}
+	t0, t1 := from.UnixNano(), to.UnixNano()
+	for j := start; j < end; j++ {
+		r := &h.records[j%len(h.records)]
+		if r.time < t0 || r.time >= t1 {
+			continue
+		}
+		if b := (r.time - t0) / int64(step); b != bucket {
+			flush()
+			bucket = b
+		}
+		for i, v := range r.values {
+			if count == 0 || v < min[i] {
+				min[i] = v
+			}
+			if count == 0 || v > max[i] {
+				max[i] = v
+			}
+			if count == 0 {
+				sum[i] = 0
+			}
+			sum[i] += float64(v)
+		}
+		count++
+	}
+	flush()
+	return resp
+}
+
+// oldest returns the time of the oldest measurements, or 'now' if there are none
+func (h *historyBuffer) oldest(now time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.full:
+		return time.Unix(0, h.records[h.next].time)
+	case h.next > 0:
+		return time.Unix(0, h.records[0].time)
+	}
+	return now
+}
+
+// parseTime parses an RFC 3339 time, Unix time in seconds, or a duration before 'now'
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(sec*1e9)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', must be RFC 3339, Unix time or a duration before now", s)
+}
+
+func history(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		source, ok := r.URL.Query()["source"]
+		if !ok || len(source) != 1 {
+			http.Error(w, "'source' argument missing", http.StatusBadRequest)
+			return
+		}
+		p, ok := s.processors[source[0]]
+		if !ok {
+			http.Error(w, fmt.Sprintf("'%s' input not defined", source[0]), http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		h := p.history
+		blockTime := time.Duration(float64(p.cfg.BlockSize()) / p.cfg.SampleRate * float64(time.Second))
+		p.mu.Unlock()
+		if h == nil {
+			http.Error(w, fmt.Sprintf("no history of '%s' input", source[0]), http.StatusServiceUnavailable)
+			return
+		}
+
+		now := time.Now()
+		from, to := h.oldest(now), now.Add(time.Nanosecond)
+		var err error
+		if v := r.URL.Query().Get("from"); v != "" {
+			if from, err = parseTime(v, now); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			if to, err = parseTime(v, now); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if !to.After(from) {
+			http.Error(w, "'to' must be after 'from'", http.StatusBadRequest)
+			return
+		}
+		// By default one step per block, or the steps of at most 1000 points
+		step := time.Duration(math.Max(float64(blockTime), float64(to.Sub(from)/1000)))
+		if v := r.URL.Query().Get("step"); v != "" {
+			if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+				http.Error(w, fmt.Sprintf("invalid step '%s'", v), http.StatusBadRequest)
+				return
+			}
+		}
+		if to.Sub(from)/step > maxHistoryPoints {
+			http.Error(w, fmt.Sprintf("more than %d steps, use a longer step", maxHistoryPoints), http.StatusBadRequest)
+			return
+		}
+
+		resp := h.aggregate(from, to, step)
+		resp.Source = source[0]
+		buf, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	h := newHistory(25)
+	// 3 s of blocks every 100 ms, the first 0.5 s are overwritten
+	for i := 0; i < 30; i++ {
+		m := ils.Meas{DDM: float32(i), RF: -float32(i)}
+		h.add(start.Add(time.Duration(i)*100*time.Millisecond), &m)
+	}
+	if got := h.oldest(start); !got.Equal(start.Add(500 * time.Millisecond)) {
+		t.Errorf("oldest measurements at %v, want %v", got, start.Add(500*time.Millisecond))
+	}
+
+	resp := h.aggregate(start, start.Add(10*time.Second), time.Second)
+	wantTime := []time.Time{start, start.Add(time.Second), start.Add(2 * time.Second)}
+	if len(resp.Time) != 3 || !resp.Time[0].Equal(wantTime[0]) || !resp.Time[2].Equal(wantTime[2]) ||
+		!reflect.DeepEqual(resp.Count, []int{5, 10, 10}) {
+		t.Errorf("steps %v with %v blocks, want %v with [5 10 10]", resp.Time, resp.Count, wantTime)
+	}
+	want := series{Min: []float32{5, 10, 20}, Mean: []float32{7, 14.5, 24.5}, Max: []float32{9, 19, 29}}
+	if ddm := resp.Values["ddm"]; !reflect.DeepEqual(ddm, want) {
+		t.Errorf("DDM %+v, want %+v", ddm, want)
+	}
+	if rf := resp.Values["rf"]; rf.Min[0] != -9 || rf.Max[0] != -5 {
+		t.Errorf("RF %+v", rf)
+	}
+
+	// Half open interval
+	resp = h.aggregate(start.Add(1500*time.Millisecond), start.Add(2*time.Second), 200*time.Millisecond)
+	if !reflect.DeepEqual(resp.Count, []int{2, 2, 1}) || !reflect.DeepEqual(resp.Values["ddm"].Max, []float32{16, 18, 19}) {
+		t.Errorf("got %v blocks, DDM %+v", resp.Count, resp.Values["ddm"])
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	cfg := ils.Config{SampleRate: 1e6, Integration: ils.DefaultIntegration}
+	p := &processor{cfg: cfg, history: newHistory(100)}
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		m := ils.Meas{SDM: 40 + float32(i%2)}
+		p.history.add(now.Add(time.Duration(i-20)*100*time.Millisecond), &m)
+	}
+	s := &httpapi{processors: map[string]*processor{"loc": p, "gp": {}}}
+	get := func(query string) (historyResponse, int) {
+		w := httptest.NewRecorder()
+		history(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history?"+query, nil))
+		var resp historyResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, w.Code
+	}
+
+	resp, code := get("source=loc")
+	if code != http.StatusOK || len(resp.Count) != 20 || resp.Step != 0.1 {
+		t.Errorf("status %d, %d steps of %g s, want 20 steps of 0.1 s", code, len(resp.Count), resp.Step)
+	}
+	resp, code = get("source=loc&from=10s&step=1m")
+	if code != http.StatusOK || !reflect.DeepEqual(resp.Count, []int{20}) || resp.Values["sdm"].Mean[0] != 40.5 {
+		t.Errorf("status %d, %v blocks, SDM %+v, want one step of 20 blocks with mean 40.5%%", code, resp.Count, resp.Values["sdm"])
+	}
+	for _, query := range []string{"source=vor", "source=loc&from=yesterday", "source=loc&step=0s", "source=loc&from=1h&to=2h", "source=loc&from=1h&step=1ms"} {
+		if _, code := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+	if _, code := get("source=gp"); code != http.StatusServiceUnavailable {
+		t.Errorf("status %d without a history, want 503", code)
+	}
+}
@@ -20,19 +20,16 @@ import (
 	"os"
 	"time"
 
-	"github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/channels"
+	"github.com/asgaut/dumpils/pkg/siggen"
 )
 
-type channelType struct {
-	Name string  `json:"name"`
-	LOC  float32 `json:"loc"`
-	GP   float32 `json:"gp"`
-}
-
 type httpapi struct {
 	commands   chan interface{}
-	channel    channelType
+	channel    channels.Channel
 	processors map[string]*processor
+	record     recordSettings
+	events     *broadcaster
 }
 
 // ServeAPI serves webapi until the context is done
@@ -43,17 +40,25 @@ func (s *httpapi) ServeAPI(ctx context.Context, listenAddr string) error {
 	router.Handle("/", http.FileServer(FS(false)))
 	router.Handle("/spectrum", spectrum(s))
 	router.Handle("/measurements", meas(s))
+	router.Handle("/events", events(s))
+	router.Handle("/history", history(s))
+	router.Handle("/metrics", metrics(s))
+	router.Handle("/alarms", alarms(s))
 	router.Handle("/channel", channel(s))
+	router.Handle("/channels", channelList())
 	router.Handle("/samples", samples(s))
+	router.Handle("/generator", generator(s))
+	router.Handle("/record", record(s))
 
 	server := &http.Server{
-		Addr:         listenAddr,
-		Handler:      tracing()(logging(logger)(router)),
-		ErrorLog:     logger,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		Addr:        listenAddr,
+		Handler:     tracing()(logging(logger)(router)),
+		ErrorLog:    logger,
+		ReadTimeout: 5 * time.Second,
+		IdleTimeout: 15 * time.Second,
+		// No WriteTimeout, it would end the /events streams
 	}
+	server.RegisterOnShutdown(s.events.close)
 
 	done := make(chan bool)
 
@@ -106,6 +111,10 @@ func spectrum(s *httpapi) http.Handler {
 
 			p.mu.Lock()
 			defer p.mu.Unlock()
+			if p.demodulator == nil {
+				http.Error(w, fmt.Sprintf("'%s' input not running", source[0]), http.StatusServiceUnavailable)
+				return
+			}
 			var ret []float32
 			if stage[0] == "if" {
 				ret = p.demodulator.Spectrum1()
@@ -125,10 +134,12 @@ func spectrum(s *httpapi) http.Handler {
 
 func meas(s *httpapi) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		data := map[string]demod2.Meas{}
+		data := map[string]measurements{}
 		for key, p := range s.processors {
 			p.mu.Lock()
-			data[key] = p.demodulator.Meas
+			m := p.meas
+			m.Status = p.status()
+			data[key] = m
 			p.mu.Unlock()
 		}
 		buf, err := json.Marshal(data)
@@ -146,12 +157,16 @@ func channel(s *httpapi) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// https://www.alexedwards.net/blog/how-to-properly-parse-a-json-request-body
 		if r.Method == http.MethodPut {
-			var newChannel channelType
+			var newChannel channels.Channel
 			err := json.NewDecoder(r.Body).Decode(&newChannel)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			if err := channels.Validate(newChannel); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			s.commands <- newChannel
 			s.channel = newChannel
 		}
@@ -168,6 +183,19 @@ func channel(s *httpapi) http.Handler {
 	})
 }
 
+func channelList() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := json.Marshal(channels.All())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+}
+
 func samples(s *httpapi) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -197,16 +225,124 @@ func samples(s *httpapi) http.Handler {
 				http.Error(w, fmt.Sprintf("Content-Length must be %d bytes", len(p.iqRawData)), http.StatusBadRequest)
 				return
 			}
-			_, err := io.ReadFull(r.Body, p.iqRawData)
+			buf := make([]byte, len(p.iqRawData))
+			_, err := io.ReadFull(r.Body, buf)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			if err := p.setSamples(buf); err != nil {
+				http.Error(w, fmt.Sprintf("'%s' input: %v", source[0], err), http.StatusConflict)
+				return
+			}
 			w.WriteHeader(http.StatusAccepted)
 		}
 	})
 }
 
+func generator(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if r.Method == http.MethodOptions {
+			return // CORS preflight of PUT
+		}
+		source, ok := r.URL.Query()["source"]
+		if !ok || len(source) != 1 {
+			http.Error(w, "'source' argument missing", http.StatusBadRequest)
+			return
+		}
+		p, ok := s.processors[source[0]]
+		if !ok {
+			http.Error(w, fmt.Sprintf("'%s' input not defined", source[0]), http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.Method == http.MethodPut {
+			var params siggen.Params
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := params.Validate(p.cfg.SampleRate, p.cfg.Offset); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := p.setSignal(params); err != nil {
+				http.Error(w, fmt.Sprintf("'%s' input: %v", source[0], err), http.StatusConflict)
+				return
+			}
+		}
+		if p.gen == nil {
+			http.Error(w, fmt.Sprintf("'%s' input is not generating a signal", source[0]), http.StatusConflict)
+			return
+		}
+		buf, err := json.Marshal(p.gen.Params())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+}
+
+// recordStatus is the response of the /record endpoint
+type recordStatus struct {
+	Recording bool   `json:"recording"`
+	File      string `json:"file"` // The file being written or the last file written
+}
+
+func record(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		source, ok := r.URL.Query()["source"]
+		if !ok || len(source) != 1 {
+			http.Error(w, "'source' argument missing", http.StatusBadRequest)
+			return
+		}
+		p, ok := s.processors[source[0]]
+		if !ok {
+			http.Error(w, fmt.Sprintf("'%s' input not defined", source[0]), http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.Method == http.MethodPost {
+			switch action := r.URL.Query().Get("action"); action {
+			case "", "start":
+				if err := p.startRecording(source[0], s.record); err != nil {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+			case "stop":
+				if err := p.stopRecording(); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			default:
+				http.Error(w, fmt.Sprintf("unknown action '%s', must be start or stop", action), http.StatusBadRequest)
+				return
+			}
+		}
+		status := recordStatus{Recording: p.recorder != nil, File: p.recorded}
+		if p.recorder != nil && p.recorder.File() != "" {
+			status.File = p.recorder.File()
+		}
+		buf, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	})
+}
+
 func logging(logger *log.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -7,9 +7,19 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/channels"
+	_ "github.com/asgaut/dumpils/pkg/demod"
+	_ "github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/marker"
+	"github.com/asgaut/dumpils/pkg/measlog"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
 )
 
 var dataSource = map[string]string{
@@ -22,19 +32,74 @@ var processors = map[string]*processor{
 	"gp":  {},
 }
 
-func parseCommandLine() {
-	var s1, s2 string
-	flag.StringVar(&s1, "loc", "", "address and port of rtl_tcp or filename for LOC data")
-	flag.StringVar(&s2, "gp", "", "address and port of rtl_tcp or filename for GP data")
+var recording recordSettings
+
+// sourceOptions holds the settings of the sources not given by their URI
+var sourceOptions = source.Options{Gain: gain}
+
+func parseCommandLine() ils.Config {
+	var s1, s2, s3, s4, algorithm string
+	var vorFreq float64
+	var retention time.Duration
+	var logging logSettings
+	var alarmRules, ident string
+	var cfg ils.Config
+	flag.StringVar(&s1, "loc", "", "source of LOC data: rtltcp://host:port, file:///capture.cu8?rate=1310720 or sim:// (default sim://)")
+	flag.StringVar(&s2, "gp", "", "source of GP data: rtltcp://host:port, file:///capture.cu8?rate=1310720 or sim:// (default sim://)")
+	flag.StringVar(&s3, "mkr", "", "source of marker beacon data: rtltcp://host:port, file:///capture.cu8 or sim:// (disabled if empty)")
+	flag.StringVar(&s4, "vor", "", "source of VOR data: rtltcp://host:port, file:///capture.cu8 or sim:// (disabled if empty)")
+	flag.Float64Var(&vorFreq, "vorfreq", 0, "VOR frequency in MHz (0 to set it with the channel command)")
+	flag.StringVar(&algorithm, "algorithm", "demod2", fmt.Sprintf("demodulation algorithm of the localizer and glide path %v", ils.Algorithms()))
+	flag.Float64Var(&cfg.SampleRate, "rate", 10.0*float64(1<<17), "sample rate in Hz, e.g. 1024000, 2048000 or 2400000")
+	flag.Float64Var(&cfg.Offset, "offset", 200.0e3, "channel frequency relative to the tuned center frequency in Hz (offset tuning)")
+	flag.DurationVar(&cfg.Integration, "integration", ils.DefaultIntegration, "integration period of the measurements")
+	flag.Float64Var(&cfg.Overlap, "overlap", 0, "fraction of the integration period shared by successive measurements (0 <= overlap < 1)")
+	flag.BoolVar(&cfg.AFC, "afc", false, "retune the channel filter to follow the carrier frequency (demod2 only)")
+	flag.StringVar(&sourceOptions.Format, "format", "", fmt.Sprintf("sample format %v of raw IQ files (default from the file extension, else cu8)", iq.Formats()))
+	flag.StringVar(&recording.dir, "recdir", ".", "directory of the IQ files recorded with POST /record")
+	flag.Int64Var(&recording.maxSize, "recsize", 1<<30, "maximum size of a recorded IQ file in bytes (0 for no limit)")
+	flag.DurationVar(&recording.maxDuration, "rectime", 10*time.Minute, "maximum duration of a recorded IQ file (0 for no limit)")
+	flag.DurationVar(&retention, "history", time.Hour, "length of the measurement history of each source served at /history (0 to disable)")
+	flag.StringVar(&logging.dir, "logdir", "", "directory of the measurement logs of each source (disabled if empty)")
+	flag.StringVar(&logging.opts.Format, "logformat", measlog.CSV, fmt.Sprintf("format of the measurement logs: %s or %s", measlog.CSV, measlog.JSONL))
+	flag.BoolVar(&logging.opts.Daily, "logdaily", true, "start a new measurement log every day (UTC)")
+	flag.Int64Var(&logging.opts.MaxSize, "logsize", 100<<20, "maximum size of a measurement log in bytes (0 for no limit)")
+	flag.BoolVar(&logging.opts.Compress, "logcompress", true, "compress the complete measurement logs with gzip")
+	flag.StringVar(&alarmRules, "alarms", "", "JSON file of the alarm rules of each source (default ICAO limits of LOC and GP)")
+	flag.StringVar(&ident, "ident", "", "identifier of the localizer, keyed by the simulator and checked by the default ident alarm rule (none if empty)")
 	flag.Parse()
 	dataSource["loc"] = s1
 	dataSource["gp"] = s2
+	for name, p := range processors {
+		p.name = name
+		p.algorithm = algorithm
+		p.cfg = cfg
+		p.retention = retention
+		p.logging = logging
+	}
+	localizer, glidePath := siggen.Localizer(), siggen.GlidePath()
+	localizer.Ident = ident
+	processors["loc"].signal = &localizer
+	processors["gp"].signal = &glidePath
+	if s3 != "" {
+		dataSource["mkr"] = s3
+		processors["mkr"] = &processor{name: "mkr", kind: markerReceiver, cfg: cfg, freq: marker.Frequency, retention: retention, logging: logging}
+	}
+	if s4 != "" {
+		dataSource["vor"] = s4
+		processors["vor"] = &processor{name: "vor", kind: vorReceiver, cfg: cfg, freq: vorFreq * 1e6, retention: retention, logging: logging}
+	}
+	if err := setupAlarms(alarmRules, ident, processors); err != nil {
+		log.Fatalf("Error in alarm rules: %v", err)
+	}
+	return cfg
 }
 
 func main() {
 	log.SetOutput(os.Stdout)
 
-	parseCommandLine()
+	cfg := parseCommandLine()
+	channelOffset := cfg.Offset
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	var cancel context.CancelFunc
@@ -48,26 +113,18 @@ func main() {
 		signal.Stop(sigChan)
 	}()
 
-	channelOffset := 200.0e3    // offset tuning
-	fs := 10.0 * float64(1<<17) // 1310720.0 Hz
-
 	wg := sync.WaitGroup{}
 
+	events := newBroadcaster()
 	for key := range processors {
+		processors[key].events = events
+	}
+	for key := range processors {
+		wg.Add(1)
 		go func(src string) {
-			wg.Add(1)
 			defer wg.Done()
 			fmt.Printf("Starting processor for %s\n", src)
-			err := error(nil)
-			if dataSource[src] != "" {
-				if strings.ContainsAny(dataSource[src], ":") {
-					err = processors[src].sdrProcess(ctx, dataSource[src], fs)
-				} else {
-					err = processors[src].fileProcess(ctx, dataSource[src], fs)
-				}
-			} else {
-				err = processors[src].simProcess(ctx, fs)
-			}
+			err := processors[src].run(ctx, dataSource[src], sourceOptions)
 			if err != nil {
 				log.Printf("Error in processor '%s': %v\n", src, err)
 			}
@@ -78,10 +135,12 @@ func main() {
 	ha := httpapi{
 		commands:   make(chan interface{}, 1),
 		processors: processors,
+		record:     recording,
+		events:     events,
 	}
 	webui := "localhost:3344"
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 		fmt.Printf("Go to http://%s to access the web user interface\n", webui)
 		if err := ha.ServeAPI(ctx, webui); err != nil {
@@ -98,14 +157,23 @@ Loop:
 		case <-ctx.Done():
 			break Loop
 		case cmd := <-ha.commands:
-			if newChannel, ok := cmd.(channelType); ok {
-				fLOC := uint32(newChannel.LOC*1e6 - float32(channelOffset))
-				fGP := uint32(newChannel.GP*1e6 - float32(channelOffset))
-				log.Printf("Setting frequencies (offset=-%f) %d/%d", channelOffset, fLOC, fGP)
-				err0 := processors["loc"].setCenterFreq(fLOC)
-				err1 := processors["gp"].setCenterFreq(fGP)
-				if err0 != nil || err1 != nil {
-					log.Printf("Error setting frequencies %d/%d: '%v' '%v'", fLOC, fGP, err0, err1)
+			if newChannel, ok := cmd.(channels.Channel); ok {
+				if newChannel.LOC != 0 {
+					fLOC := uint32(newChannel.LOC*1e6 - channelOffset)
+					fGP := uint32(newChannel.GP*1e6 - channelOffset)
+					log.Printf("Setting frequencies (offset=-%f) %d/%d", channelOffset, fLOC, fGP)
+					err0 := processors["loc"].setCenterFreq(fLOC)
+					err1 := processors["gp"].setCenterFreq(fGP)
+					if err0 != nil || err1 != nil {
+						log.Printf("Error setting frequencies %d/%d: '%v' '%v'", fLOC, fGP, err0, err1)
+					}
+				}
+				if p, ok := processors["vor"]; ok && newChannel.VOR != 0 {
+					fVOR := uint32(newChannel.VOR*1e6 - channelOffset)
+					log.Printf("Setting VOR frequency (offset=-%f) %d", channelOffset, fVOR)
+					if err := p.setCenterFreq(fVOR); err != nil {
+						log.Printf("Error setting VOR frequency %d: '%v'", fVOR, err)
+					}
 				}
 			}
 		}
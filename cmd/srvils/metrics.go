@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+// metric is a metric of each source in the Prometheus text format.
+// The measurements are only exposed once a block is processed.
+type metric struct {
+	name  string
+	kind  string // gauge, counter or summary
+	help  string
+	meas  bool // a measurement of the last block
+	value func(p *processor) float64
+	count func(p *processor) float64 // the count of a summary, whose sum is value
+}
+
+var sourceMetrics = []metric{
+	{"srvils_rf_level_dbfs", "gauge", "RF level of the carrier", true,
+		func(p *processor) float64 { return float64(p.meas.RF) }, nil},
+	{"srvils_ddm_percent", "gauge", "Difference in depth of modulation (150 Hz - 90 Hz)", true,
+		func(p *processor) float64 { return float64(p.meas.DDM) }, nil},
+	{"srvils_sdm_percent", "gauge", "Sum of the depths of modulation", true,
+		func(p *processor) float64 { return float64(p.meas.SDM) }, nil},
+	{"srvils_mod90_percent", "gauge", "Depth of modulation of the 90 Hz tone", true,
+		func(p *processor) float64 { return float64(p.meas.Mod90) }, nil},
+	{"srvils_mod150_percent", "gauge", "Depth of modulation of the 150 Hz tone", true,
+		func(p *processor) float64 { return float64(p.meas.Mod150) }, nil},
+	{"srvils_ident_depth_percent", "gauge", "Depth of modulation of the ident tone", true,
+		func(p *processor) float64 { return float64(p.meas.Ident.Depth) }, nil},
+	{"srvils_carrier_offset_hertz", "gauge", "Frequency of the carrier relative to the channel frequency", true,
+		func(p *processor) float64 { return float64(p.meas.Offset) }, nil},
+	{"srvils_last_block_timestamp_seconds", "gauge", "Unix time when the last block was processed", true,
+		func(p *processor) float64 { return float64(p.time.UnixNano()) / 1e9 }, nil},
+	{"srvils_source_up", "gauge", "1 if the source delivers samples, 0 if it is reconnecting or stopped", false,
+		func(p *processor) float64 {
+			if p.status() == source.StatusOK {
+				return 1
+			}
+			return 0
+		}, nil},
+	{"srvils_blocks_processed_total", "counter", "Number of blocks demodulated", false,
+		func(p *processor) float64 { return float64(p.blocks) }, nil},
+	{"srvils_read_errors_total", "counter", "Number of failed reads from the source", false,
+		func(p *processor) float64 {
+			n := p.readErrors
+			if c, ok := p.src.(source.Connection); ok {
+				n += uint64(c.ReadErrors())
+			}
+			return float64(n)
+		}, nil},
+	{"srvils_reconnects_total", "counter", "Number of times the connection to the source was restored", false,
+		func(p *processor) float64 {
+			if c, ok := p.src.(source.Connection); ok {
+				return float64(c.Reconnects())
+			}
+			return 0
+		}, nil},
+	{"srvils_dropped_blocks_total", "counter", "Number of blocks missing in the stream of samples, estimated from the sample rate", false,
+		func(p *processor) float64 { return float64(p.dropped) }, nil},
+	{"srvils_process_duration_seconds", "summary", "Time spent demodulating the blocks", false,
+		func(p *processor) float64 { return p.procTime.Seconds() },
+		func(p *processor) float64 { return float64(p.blocks) }},
+}
+
+// formatValue formats a sample value in the Prometheus text format
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metrics serves the measurements and the state of each source in the
+// Prometheus text exposition format
+func metrics(s *httpapi) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		names := make([]string, 0, len(s.processors))
+		for name := range s.processors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// Take the values of each source at once
+		values := make(map[string][][2]float64, len(names))
+		measured := make(map[string]bool, len(names))
+		for _, name := range names {
+			p := s.processors[name]
+			p.mu.Lock()
+			v := make([][2]float64, len(sourceMetrics))
+			measured[name] = p.blocks > 0
+			for i, m := range sourceMetrics {
+				if m.meas && !measured[name] {
+					continue
+				}
+				v[i][0] = m.value(p)
+				if m.count != nil {
+					v[i][1] = m.count(p)
+				}
+			}
+			values[name] = v
+			p.mu.Unlock()
+		}
+
+		var buf bytes.Buffer
+		for i, m := range sourceMetrics {
+			fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+			for _, name := range names {
+				v := values[name][i]
+				switch {
+				case m.meas && !measured[name]:
+				case m.count != nil:
+					fmt.Fprintf(&buf, "%s_sum{source=%q} %s\n", m.name, name, formatValue(v[0]))
+					fmt.Fprintf(&buf, "%s_count{source=%q} %s\n", m.name, name, formatValue(v[1]))
+				default:
+					fmt.Fprintf(&buf, "%s{source=%q} %s\n", m.name, name, formatValue(v[0]))
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+func TestMetrics(t *testing.T) {
+	p := &processor{name: "loc", blocks: 20, dropped: 3, procTime: 250 * time.Millisecond,
+		meas: measurements{Meas: ils.Meas{DDM: -0.5, SDM: 40, RF: -12.5}}, time: time.Unix(1589710830, 0)}
+	s := &httpapi{processors: map[string]*processor{"loc": p, "gp": {}}}
+	w := httptest.NewRecorder()
+	metrics(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %s", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE srvils_ddm_percent gauge",
+		`srvils_ddm_percent{source="loc"} -0.5`,
+		`srvils_rf_level_dbfs{source="loc"} -12.5`,
+		`srvils_last_block_timestamp_seconds{source="loc"} 1.58971083e+09`,
+		`srvils_source_up{source="gp"} 0`,
+		`srvils_blocks_processed_total{source="gp"} 0`,
+		`srvils_blocks_processed_total{source="loc"} 20`,
+		`srvils_dropped_blocks_total{source="loc"} 3`,
+		"# TYPE srvils_process_duration_seconds summary",
+		`srvils_process_duration_seconds_sum{source="loc"} 0.25`,
+		`srvils_process_duration_seconds_count{source="loc"} 20`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	// No measurements of a source before the first block
+	if strings.Contains(body, `srvils_ddm_percent{source="gp"}`) {
+		t.Errorf("measurements of a source without blocks:\n%s", body)
+	}
+}
+
+func TestCountDropped(t *testing.T) {
+	// 10 blocks per second
+	p := &processor{cfg: ils.Config{SampleRate: 1e6, Integration: ils.DefaultIntegration}}
+	start := time.Now()
+	at := func(ms int) {
+		p.countDropped(start.Add(time.Duration(ms) * time.Millisecond))
+	}
+	for i := 0; i < 10; i++ {
+		at(i * 100)
+	}
+	at(1500) // 0.5 s late
+	if p.dropped != 0 {
+		t.Errorf("%d blocks dropped, want 0", p.dropped)
+	}
+	at(2600) // 1.5 s late
+	if p.dropped != 15 {
+		t.Errorf("%d blocks dropped, want 15", p.dropped)
+	}
+	for i := 1; i < 10; i++ {
+		at(2600 + i*100)
+	}
+	if p.dropped != 15 {
+		t.Errorf("%d blocks dropped, want 15 after the gap", p.dropped)
+	}
+}
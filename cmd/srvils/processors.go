@@ -3,126 +3,394 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"net"
-	"os"
+	"math"
 	"sync"
 	"time"
 
-	"github.com/asgaut/dumpils/pkg/demod2"
-	"github.com/bemasher/rtltcp"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/measlog"
+	"github.com/asgaut/dumpils/pkg/monitor"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
 )
 
+// gain is the tuner gain in dB of rtl_tcp sources.
+// rtl_test reports these gain values for all my dongles:
+// 0.0 0.9 1.4 2.7 3.7 7.7 8.7 12.5 14.4 15.7 16.6 19.7 20.7 22.9 25.4 28.0 29.7 32.8 33.8 36.4 37.2 38.6 40.2 42.1 43.4 43.9 44.5 48.0 49.6
+const gain = 4.0
+
 type processor struct {
-	mu          sync.Mutex
-	demodulator *demod2.Demodulator
-	sdr         rtltcp.SDR
-	iqRawData   []byte
+	mu           sync.Mutex
+	name         string
+	algorithm    string // ILS demodulation algorithm
+	kind         string // ilsReceiver, markerReceiver or vorReceiver
+	cfg          ils.Config
+	freq         float64 // fixed channel frequency in Hz, or 0 if set by the channel command
+	demodulator  receiver
+	meas         measurements
+	time         time.Time      // when meas was processed
+	blocks       uint64         // number of blocks processed
+	readErrors   uint64         // number of reads which ended the processing
+	dropped      uint64         // number of blocks missing in the stream of samples
+	procTime     time.Duration  // total time spent in Process
+	streamStart  time.Time      // when the first block since the last gap in the stream was received
+	streamBlocks uint64         // number of blocks received since streamStart
+	events       *broadcaster   // receives the measurements of each block, or nil
+	retention    time.Duration  // length of the history
+	history      *historyBuffer // measurements of the last blocks, nil if retention is 0
+	logging      logSettings
+	logger       *measlog.Logger  // measurement log, nil if not logging
+	monitor      *monitor.Monitor // checks the measurements against the alarm rules, nil if none
+	alarms       []monitor.Event  // state changes of the alarm rules in the last block
+	src          source.SampleSource
+	signal       *siggen.Params    // signal synthesized by a simulator source, nil for none
+	gen          *siggen.Generator // generator of the simulator source, nil if not generating
+	format       iq.Format         // sample format of iqRawData
+	recorder     *iq.Recorder
+	recorded     string // name of the last file written by a stopped recorder
+	ident        string // last decoded identifier
+	iqRawData    []byte
+	iqSamples    []complex64
 }
 
-func (p *processor) setCenterFreq(freq uint32) (err error) {
-	if p.sdr.TCPConn != nil {
-		return p.sdr.SetCenterFreq(freq)
+// recordSettings holds the limits of the recorded files
+type recordSettings struct {
+	dir         string
+	maxSize     int64
+	maxDuration time.Duration
+}
+
+// logSettings holds the directory and the options of the measurement log
+type logSettings struct {
+	dir  string // no log if empty
+	opts measlog.Options
+}
+
+// startRecording starts recording the samples of the processor 'name'.
+// The caller must hold the mutex.
+func (p *processor) startRecording(name string, settings recordSettings) error {
+	if _, ok := p.src.(*source.RTLTCP); !ok {
+		return fmt.Errorf("'%s' is not an rtl_tcp source", name)
+	}
+	if p.recorder == nil {
+		p.recorder = iq.NewRecorder(settings.dir, name, settings.maxSize, settings.maxDuration, p.src.Metadata())
 	}
 	return nil
 }
 
-func (p *processor) sdrProcess(ctx context.Context, address string, fs float64) error {
-	// rtl_test reports these gain values for all my dongles:
-	// 0.0 0.9 1.4 2.7 3.7 7.7 8.7 12.5 14.4 15.7 16.6 19.7 20.7 22.9 25.4 28.0 29.7 32.8 33.8 36.4 37.2 38.6 40.2 42.1 43.4 43.9 44.5 48.0 49.6
-	addr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		return err
+// stopRecording closes the recorded file. The caller must hold the mutex.
+func (p *processor) stopRecording() error {
+	if p.recorder == nil {
+		return nil
 	}
-	if err := p.sdr.Connect(addr); err != nil {
-		return err
+	err := p.recorder.Close()
+	if name := p.recorder.File(); name != "" {
+		p.recorded = name
 	}
-	defer p.sdr.Close()
-	p.sdr.SetSampleRate(uint32(fs))
-	p.sdr.SetGain(40) // must set gain to avoid automatic setting
+	p.recorder = nil
+	return err
+}
 
-	p.iqRawData = make([]byte, int(fs/10)*2)
-	p.demodulator = demod2.NewDemodulator(fs, int(fs/10))
+// record writes the samples in iqRawData to the recorded file. The caller must hold the mutex.
+func (p *processor) record() {
+	if p.recorder == nil {
+		return
+	}
+	if _, err := p.recorder.Write(p.iqRawData); err != nil {
+		log.Printf("Error recording to '%s': %v", p.recorder.File(), err)
+		p.stopRecording()
+	}
+}
 
-	go func() {
-		<-ctx.Done()
-		log.Println("Closing SDR connection")
-		// this terminates any read operations
-		p.sdr.Close()
-	}()
+// annotate marks a new identifier decoded in the last block and the alarm
+// state changes in the recorded file. The caller must hold the mutex.
+func (p *processor) annotate() {
+	text := p.meas.Ident.Text
+	if p.recorder != nil && text != "" && text != p.ident {
+		p.recorder.Annotate("ident", text, int64(len(p.iqSamples)))
+	}
+	p.ident = text
+	if p.recorder != nil {
+		for _, e := range p.alarms {
+			p.recorder.Annotate("alarm", e.String(), int64(len(p.iqSamples)))
+		}
+	}
+}
 
-	for {
-		_, err := io.ReadFull(p.sdr, p.iqRawData)
-		if err != nil {
-			log.Println("Error reading from SDR", err)
+// writeLog writes the measurements of the last block to the measurement log.
+// The caller must hold the mutex.
+func (p *processor) writeLog() {
+	if p.logger == nil {
+		return
+	}
+	m := p.meas
+	if err := p.logger.Log(p.time, p.status(), measlog.Record{Meas: m.Meas, Marker: m.Marker, VOR: m.VOR}); err != nil {
+		log.Printf("Error logging measurements to '%s': %v", p.logger.File(), err)
+		p.closeLog()
+	}
+}
+
+// closeLog closes the measurement log. The caller must hold the mutex.
+func (p *processor) closeLog() {
+	if p.logger == nil {
+		return
+	}
+	if err := p.logger.Close(); err != nil {
+		log.Printf("Error closing measurement log '%s': %v", p.logger.File(), err)
+	}
+	p.logger = nil
+}
+
+// maxLag is the delay of the samples of a source, relative to their sample
+// rate, after which the missing blocks are counted as dropped
+const maxLag = time.Second
+
+// countDropped counts the blocks missing in the stream of samples at the
+// arrival of a block at time 'now'. The samples are expected in real time
+// since the first block, or the last gap. The caller must hold the mutex.
+func (p *processor) countDropped(now time.Time) {
+	period := time.Duration(float64(p.cfg.BlockSize()) / p.cfg.SampleRate * float64(time.Second))
+	lag := now.Sub(p.streamStart) - time.Duration(p.streamBlocks)*period
+	if p.streamStart.IsZero() || lag > maxLag || lag < -maxLag {
+		if !p.streamStart.IsZero() && lag > 0 {
+			p.dropped += uint64(lag / period)
+		}
+		p.streamStart, p.streamBlocks = now, 0
+	}
+	p.streamBlocks++
+}
+
+// status returns the state of the source. The caller must hold the mutex.
+func (p *processor) status() string {
+	if p.src == nil {
+		return source.StatusStopped
+	}
+	if c, ok := p.src.(source.Connection); ok {
+		return c.Status()
+	}
+	return source.StatusOK
+}
+
+// setup allocates the sample buffers and the history, creates the
+// measurement log and creates the demodulator
+func (p *processor) setup() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.retention > 0 {
+		p.history = newHistory(int(math.Ceil(p.retention.Seconds() * p.cfg.SampleRate / float64(p.cfg.BlockSize()))))
+	}
+	if p.logging.dir != "" {
+		if p.logger, err = measlog.New(p.logging.dir, p.name, p.logging.opts); err != nil {
 			return err
 		}
-		p.mu.Lock()
-		p.demodulator.Process(p.iqRawData)
-		p.mu.Unlock()
 	}
+	if p.format.Size == 0 {
+		p.format = iq.CU8
+	}
+	p.iqRawData = make([]byte, p.cfg.BlockSize()*p.format.Size)
+	p.iqSamples = make([]complex64, p.cfg.BlockSize())
+	p.demodulator, err = newReceiver(p.kind, p.algorithm, p.cfg)
+	return err
 }
 
-func (p *processor) fileProcess(ctx context.Context, filename string, fs float64) error {
-	file, err := os.Open(filename)
+// process demodulates the samples in iqRawData. The caller must hold the mutex.
+func (p *processor) process() error {
+	p.format.Decode(p.iqSamples, p.iqRawData)
+	start := time.Now()
+	m, err := p.demodulator.process(p.iqSamples)
+	p.time = time.Now()
+	p.procTime += p.time.Sub(start)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	p.meas = m
+	p.blocks++
+	if p.history != nil {
+		p.history.add(p.time, &p.meas.Meas)
+	}
+	p.writeLog()
+	p.checkAlarms()
+	return nil
+}
 
-	p.iqRawData = make([]byte, int(fs/10)*2)
-	p.demodulator = demod2.NewDemodulator(fs, int(fs/10))
+// update returns the measurements of the last block for the clients of /events.
+// The caller must hold the mutex.
+func (p *processor) update() update {
+	u := update{Block: p.blocks, Source: p.name, Time: p.time.UTC(), Meas: p.meas}
+	u.Meas.Status = p.status()
+	if p.monitor != nil {
+		u.Alarms = p.monitor.Active()
+	}
+	u.Changes = p.alarms
+	if p.events.wantSpectra(p.name) {
+		u.Spectrum1 = p.demodulator.Spectrum1()
+		u.Spectrum2 = p.demodulator.Spectrum2()
+	}
+	return u
+}
 
-	size, _ := file.Seek(0, io.SeekEnd)
-	file.Seek(0, io.SeekStart)
-	if size < int64(len(p.iqRawData)) {
-		return fmt.Errorf("file size must be at least %d bytes", len(p.iqRawData))
+// setCenterFreq tunes the source. The caller must not hold the mutex.
+func (p *processor) setCenterFreq(freq uint32) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.src == nil {
+		return nil
+	}
+	if err := p.src.Tune(float64(freq)); err != nil {
+		return err
 	}
-	chunks := int(size / int64(len(p.iqRawData)))
+	if p.recorder != nil {
+		return p.recorder.SetCenterFrequency(p.src.Metadata().CenterFrequency)
+	}
+	return nil
+}
 
-	go func() {
-		<-ctx.Done()
-		log.Println("Closing input file")
-		// this terminates any read operations
-		file.Close()
-	}()
+// setSamples sets the samples repeated by a simulator source. The caller must hold the mutex.
+func (p *processor) setSamples(samples []byte) error {
+	sim, ok := p.src.(*source.Sim)
+	if !ok {
+		return fmt.Errorf("not a simulator source")
+	}
+	sim.SetSamples(samples)
+	p.gen = nil
+	return nil
+}
 
-	loopDuration := time.Duration(int64(time.Second) * int64(len(p.iqRawData)) / int64(fs))
-	chunksRead := 0
-	for {
-		_, err := io.ReadFull(file, p.iqRawData)
+// setSignal sets the signal synthesized by a simulator source. The caller must hold the mutex.
+func (p *processor) setSignal(params siggen.Params) error {
+	sim, ok := p.src.(*source.Sim)
+	if !ok {
+		return fmt.Errorf("not a simulator source")
+	}
+	if p.gen == nil {
+		gen, err := siggen.New(p.cfg.SampleRate, p.cfg.Offset, params)
 		if err != nil {
-			return nil
+			return err
 		}
-		chunksRead++
-		if chunksRead == chunks {
-			chunksRead = 0
-			file.Seek(0, io.SeekStart)
+		p.gen = gen
+	} else if err := p.gen.SetParams(params); err != nil {
+		return err
+	}
+	sim.SetGenerator(p.gen)
+	p.signal = &params
+	return nil
+}
+
+// open opens the source described by 'uri'. The sample rate and sample format
+// are taken from the source. The channel is received at the frequency of the
+// processor if it is fixed and the center frequency of the source is known,
+// otherwise at the configured offset.
+func (p *processor) open(uri string, opts source.Options) error {
+	opts.SampleRate = p.cfg.SampleRate
+	if p.freq != 0 {
+		opts.Center = p.freq - p.cfg.Offset // offset tuning
+	}
+	src, err := source.Open(uri, opts)
+	if err != nil {
+		return err
+	}
+	meta := src.Metadata()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.src = src
+	p.format, err = iq.LookupFormat(meta.Format)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	p.cfg.SampleRate = meta.SampleRate
+	if p.freq != 0 && meta.CenterFrequency != 0 {
+		p.cfg.Offset = p.freq - meta.CenterFrequency
+	}
+	if _, ok := src.(*source.Sim); ok && p.signal != nil {
+		if err := p.setSignal(*p.signal); err != nil {
+			src.Close()
+			return err
 		}
-		p.mu.Lock()
-		p.demodulator.Process(p.iqRawData)
-		p.mu.Unlock()
+	}
+	log.Printf("%s: %s samples at %.0f S/s, center frequency %.0f Hz", uri, meta.Format, meta.SampleRate, meta.CenterFrequency)
+	return nil
+}
+
+// watch checks the alarm rules every second while the state of the source is
+// not ok, as no blocks are processed, until the context is cancelled
+func (p *processor) watch(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
 		select {
 		case <-ctx.Done():
-			break
-		case <-time.After(loopDuration):
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			if p.status() == source.StatusOK {
+				p.mu.Unlock()
+				continue
+			}
+			p.checkLost(now)
+			u := p.update()
+			p.mu.Unlock()
+			if len(u.Changes) > 0 {
+				p.events.publish(u)
+			}
 		}
 	}
 }
 
-func (p *processor) simProcess(ctx context.Context, fs float64) error {
-	p.iqRawData = make([]byte, int(fs/10)*2)
-	p.demodulator = demod2.NewDemodulator(fs, int(fs/10))
-	loopDuration := time.Duration(int64(time.Second) * int64(len(p.iqRawData)) / int64(fs))
+// run demodulates the samples of the source described by 'uri' until the
+// context is cancelled or the source fails
+func (p *processor) run(ctx context.Context, uri string, opts source.Options) error {
+	if err := p.open(uri, opts); err != nil {
+		return err
+	}
+	defer func() {
+		p.mu.Lock()
+		p.stopRecording()
+		p.closeLog()
+		p.src.Close()
+		p.src = nil
+		p.gen = nil
+		p.mu.Unlock()
+	}()
+
+	if err := p.setup(); err != nil {
+		return err
+	}
+
+	src := p.src
+	go func() {
+		<-ctx.Done()
+		log.Printf("Closing %s", uri)
+		// this terminates any read operations
+		src.Close()
+	}()
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	go p.watch(watchCtx)
+
 	for {
+		if err := src.Read(p.iqRawData); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Error reading from %s: %v", uri, err)
+			p.mu.Lock()
+			p.readErrors++
+			p.mu.Unlock()
+			return err
+		}
 		p.mu.Lock()
-		p.demodulator.Process(p.iqRawData)
+		p.countDropped(time.Now())
+		p.record()
+		err := p.process()
+		p.annotate()
+		u := p.update()
 		p.mu.Unlock()
-		select {
-		case <-ctx.Done():
-			break
-		case <-time.After(loopDuration):
+		if err != nil {
+			return err
 		}
+		p.events.publish(u)
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/rtlserver"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+// TestRTLTCP runs a processor against an rtl_tcp server
+func TestRTLTCP(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3, Integration: ils.DefaultIntegration}
+	sim := source.NewSim(source.Options{SampleRate: cfg.SampleRate})
+	g, err := siggen.New(cfg.SampleRate, cfg.Offset, siggen.Params{Carrier: siggen.Carrier{DDM: 10, SDM: 40, RF: -6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetGenerator(g)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rtlserver.New(sim)
+	go server.Serve(l)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "srvils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &processor{algorithm: "demod2", cfg: cfg}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.run(ctx, "rtltcp://"+l.Addr().String(), source.Options{Gain: gain})
+	}()
+
+	// wait returns the measurements after 'blocks' more blocks
+	wait := func(blocks int) measurements {
+		time.Sleep(time.Duration(blocks) * cfg.Period())
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		m := p.meas
+		m.Status = p.status()
+		return m
+	}
+	m := wait(5)
+	if math.Abs(float64(m.DDM)-10) > 0.2 || math.Abs(float64(m.SDM)-40) > 0.5 || m.Status != "ok" {
+		t.Errorf("DDM %.2f%%, SDM %.2f%%, status %s, want 10%%, 40%% and ok", m.DDM, m.SDM, m.Status)
+	}
+
+	// Channel change and recording
+	if err := p.setCenterFreq(109500000 - 200000); err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	err = p.startRecording("loc", recordSettings{dir: dir})
+	p.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(3)
+	p.mu.Lock()
+	p.stopRecording()
+	p.mu.Unlock()
+	if f := server.Settings().CenterFreq; f != 109300000 {
+		t.Errorf("center frequency %d Hz, want 109300000 Hz", f)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "loc_*_109300000Hz"+iq.SigMFDataExt))
+	if len(files) != 1 || p.recorded != files[0] {
+		t.Errorf("recorded %v, last file %s, want one file", files, p.recorded)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if s := p.status(); s != source.StatusStopped {
+		t.Errorf("status %s after stopping, want stopped", s)
+	}
+}
+
+// TestSimulator changes the signal of a simulator source with the /generator endpoint
+func TestSimulator(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3, Integration: ils.DefaultIntegration}
+	signal := siggen.Localizer()
+	p := &processor{algorithm: "demod2", cfg: cfg, signal: &signal}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx, "sim://", source.Options{})
+	s := &httpapi{processors: map[string]*processor{"loc": p}}
+
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		generator(s).ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/generator?source=loc", strings.NewReader(body)))
+		return w
+	}
+	time.Sleep(3 * cfg.Period())
+	if w := put(`{"ddm": -15, "sdm": 40, "rf": -20, "ident": "ENGM", "identDepth": 10, "wpm": 7}`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if w := put(`{"ddm": 50, "sdm": 40}`); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for DDM > SDM, want 400", w.Code)
+	}
+	time.Sleep(5 * cfg.Period())
+	p.mu.Lock()
+	m := p.meas
+	p.mu.Unlock()
+	if math.Abs(float64(m.DDM)+15) > 0.2 || math.Abs(float64(m.SDM)-40) > 0.5 || math.Abs(float64(m.RF)+20) > 0.5 {
+		t.Errorf("DDM %.2f%%, SDM %.2f%%, RF %.1f dBFS, want -15%%, 40%% and -20 dBFS", m.DDM, m.SDM, m.RF)
+	}
+
+	w := httptest.NewRecorder()
+	generator(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/generator?source=loc", nil))
+	var params siggen.Params
+	if err := json.Unmarshal(w.Body.Bytes(), &params); err != nil || params.Ident != "ENGM" || params.DDM != -15 {
+		t.Errorf("got %s %v, want the signal set", w.Body, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/marker"
+	"github.com/asgaut/dumpils/pkg/vor"
+)
+
+// Receivers of a processor
+const (
+	ilsReceiver    = ""       // ILS demodulator of the algorithm of the processor
+	markerReceiver = "marker" // marker beacon receiver
+	vorReceiver    = "vor"    // VOR receiver
+)
+
+// measurements is the measurements of one block. The marker beacon and VOR
+// receivers also set the RF level, and the VOR the ident, of the ILS
+// measurements, which are kept in the history, logged and checked by the
+// alarm rules.
+type measurements struct {
+	ils.Meas
+	Marker *marker.Meas `json:"marker,omitempty"` // Marker beacon receiver only
+	VOR    *vor.Meas    `json:"vor,omitempty"`    // VOR receiver only
+	Status string       `json:"status"`           // State of the source, set when served
+}
+
+// receiver demodulates the samples of a processor
+type receiver interface {
+	process(iq []complex64) (measurements, error)
+	Spectrum1() []float32
+	Spectrum2() []float32
+}
+
+type ilsDemodulator struct{ ils.Demodulator }
+
+func (d ilsDemodulator) process(iq []complex64) (measurements, error) {
+	m, err := d.Process(iq)
+	return measurements{Meas: m}, err
+}
+
+type markerDemodulator struct{ *marker.Demodulator }
+
+func (d markerDemodulator) process(iq []complex64) (measurements, error) {
+	m, err := d.Process(iq)
+	return measurements{Meas: ils.Meas{RF: m.RF}, Marker: &m}, err
+}
+
+type vorDemodulator struct{ *vor.Demodulator }
+
+func (d vorDemodulator) process(iq []complex64) (measurements, error) {
+	m, err := d.Process(iq)
+	return measurements{Meas: ils.Meas{RF: m.RF, Ident: m.Ident}, VOR: &m}, err
+}
+
+// newReceiver creates the receiver 'kind' with the ILS demodulation 'algorithm'
+func newReceiver(kind, algorithm string, cfg ils.Config) (receiver, error) {
+	switch kind {
+	case markerReceiver:
+		d, err := marker.NewDemodulator(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return markerDemodulator{d}, nil
+	case vorReceiver:
+		d, err := vor.NewDemodulator(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return vorDemodulator{d}, nil
+	}
+	d, err := ils.New(algorithm, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ilsDemodulator{d}, nil
+}
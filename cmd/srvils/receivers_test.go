@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+func TestReceivers(t *testing.T) {
+	cfg := ils.Config{SampleRate: 1.024e6, Offset: 250e3, Integration: ils.DefaultIntegration}
+	iq := make([]complex64, cfg.BlockSize())
+	for _, c := range []struct {
+		kind, algorithm string
+		marker, vor     bool
+	}{
+		{ilsReceiver, "demod2", false, false},
+		{markerReceiver, "", true, false},
+		{vorReceiver, "", false, true},
+	} {
+		r, err := newReceiver(c.kind, c.algorithm, cfg)
+		if err != nil {
+			t.Fatalf("%q: %v", c.kind, err)
+		}
+		m, err := r.process(iq)
+		if err != nil {
+			t.Fatalf("%q: %v", c.kind, err)
+		}
+		if (m.Marker != nil) != c.marker || (m.VOR != nil) != c.vor || m.RF != ils.NoSignal {
+			t.Errorf("%q: %+v", c.kind, m)
+		}
+	}
+	// The marker beacon and VOR receivers are not ILS demodulation algorithms
+	for _, algorithm := range []string{"marker", "vor"} {
+		if _, err := newReceiver(ilsReceiver, algorithm, cfg); err == nil {
+			t.Errorf("no error for the algorithm %q", algorithm)
+		}
+	}
+}
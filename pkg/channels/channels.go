@@ -0,0 +1,164 @@
+// Package channels holds the ICAO VHF navigation channel plan (ICAO Annex 10,
+// Volume I). The channels are named by their paired DME channel, e.g. 38X.
+// The ILS channels pair a localizer frequency with a glide path frequency,
+// the other channels are VOR frequencies.
+package channels
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Channel is a navigation channel with frequencies in MHz. LOC and GP are zero
+// for VOR channels and VOR is zero for ILS channels.
+type Channel struct {
+	Name string  `json:"name"`
+	LOC  float64 `json:"loc,omitempty"`
+	GP   float64 `json:"gp,omitempty"`
+	VOR  float64 `json:"vor,omitempty"`
+}
+
+// Frequency bands in MHz
+const (
+	LOCMin = 108.1
+	LOCMax = 111.95
+	GPMin  = 328.6
+	GPMax  = 335.4
+	VORMin = 108.0
+	VORMax = 117.95
+)
+
+// tolerance is the largest difference in MHz between equal frequencies
+const tolerance = 0.001
+
+// glidePaths maps the ILS channels to the paired glide path frequencies
+var glidePaths = map[string]float64{
+	"18X": 334.7,
+	"18Y": 334.55,
+	"20X": 334.1,
+	"20Y": 333.95,
+	"22X": 329.9,
+	"22Y": 329.75,
+	"24X": 330.5,
+	"24Y": 330.35,
+	"26X": 329.3,
+	"26Y": 329.15,
+	"28X": 331.4,
+	"28Y": 331.25,
+	"30X": 332,
+	"30Y": 331.85,
+	"32X": 332.6,
+	"32Y": 332.45,
+	"34X": 333.2,
+	"34Y": 333.05,
+	"36X": 333.8,
+	"36Y": 333.65,
+	"38X": 334.4,
+	"38Y": 334.25,
+	"40X": 335,
+	"40Y": 334.85,
+	"42X": 329.6,
+	"42Y": 329.45,
+	"44X": 330.2,
+	"44Y": 330.05,
+	"46X": 330.8,
+	"46Y": 330.65,
+	"48X": 331.7,
+	"48Y": 331.55,
+	"50X": 332.3,
+	"50Y": 332.15,
+	"52X": 332.9,
+	"52Y": 332.75,
+	"54X": 333.5,
+	"54Y": 333.35,
+	"56X": 331.1,
+	"56Y": 330.95,
+}
+
+var table []Channel
+
+func init() {
+	add := func(n int, f float64) {
+		for i, suffix := range []string{"X", "Y"} {
+			c := Channel{Name: fmt.Sprintf("%d%s", n, suffix)}
+			freq := math.Round((f+0.05*float64(i))*100) / 100
+			if gp, ok := glidePaths[c.Name]; ok {
+				c.LOC, c.GP = freq, gp
+			} else {
+				c.VOR = freq
+			}
+			table = append(table, c)
+		}
+	}
+	// Channels 17 to 59 are 108.0 to 112.25 MHz, 70 to 126 are 112.3 to 117.95 MHz
+	for n := 17; n <= 59; n++ {
+		add(n, 108.0+0.1*float64(n-17))
+	}
+	for n := 70; n <= 126; n++ {
+		add(n, 112.3+0.1*float64(n-70))
+	}
+}
+
+// All returns the channels in order of frequency
+func All() []Channel {
+	return append([]Channel(nil), table...)
+}
+
+// Lookup returns the channel with the (case insensitive) name
+func Lookup(name string) (Channel, bool) {
+	for _, c := range table {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Channel{}, false
+}
+
+// ByFrequency returns the channel with a LOC, GP or VOR frequency of 'mhz'
+func ByFrequency(mhz float64) (Channel, bool) {
+	for _, c := range table {
+		for _, f := range []float64{c.LOC, c.GP, c.VOR} {
+			if f != 0 && math.Abs(f-mhz) < tolerance {
+				return c, true
+			}
+		}
+	}
+	return Channel{}, false
+}
+
+// Validate checks that the frequencies of 'c' are within their bands and that
+// LOC and GP are a pair of the channel plan. The name is not checked.
+func Validate(c Channel) error {
+	switch {
+	case c.LOC == 0 && c.GP == 0 && c.VOR == 0:
+		return fmt.Errorf("no frequency")
+	case (c.LOC == 0) != (c.GP == 0):
+		return fmt.Errorf("the localizer and glide path frequencies must both be set")
+	case c.LOC != 0 && (c.LOC < LOCMin-tolerance || c.LOC > LOCMax+tolerance):
+		return fmt.Errorf("localizer frequency %g MHz is outside %g-%g MHz", c.LOC, LOCMin, LOCMax)
+	case c.GP != 0 && (c.GP < GPMin-tolerance || c.GP > GPMax+tolerance):
+		return fmt.Errorf("glide path frequency %g MHz is outside %g-%g MHz", c.GP, GPMin, GPMax)
+	case c.VOR != 0 && (c.VOR < VORMin-tolerance || c.VOR > VORMax+tolerance):
+		return fmt.Errorf("VOR frequency %g MHz is outside %g-%g MHz", c.VOR, VORMin, VORMax)
+	}
+	for _, f := range []float64{c.LOC, c.GP} {
+		if f == 0 {
+			continue
+		}
+		ch, ok := ByFrequency(f)
+		if !ok || ch.LOC == 0 {
+			return fmt.Errorf("%g MHz is not an ILS channel frequency", f)
+		}
+		if math.Abs(ch.LOC-c.LOC) > tolerance || math.Abs(ch.GP-c.GP) > tolerance {
+			return fmt.Errorf("localizer %g MHz and glide path %g MHz are not paired, channel %s is %g/%g MHz",
+				c.LOC, c.GP, ch.Name, ch.LOC, ch.GP)
+		}
+	}
+	if c.VOR != 0 {
+		if ch, ok := ByFrequency(c.VOR); !ok || ch.VOR == 0 {
+			return fmt.Errorf("%g MHz is not a VOR channel frequency", c.VOR)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package channels
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	if n := len(All()); n != 200 {
+		t.Errorf("got %d channels, want 200", n)
+	}
+	c, ok := Lookup("38x")
+	if !ok || c != (Channel{Name: "38X", LOC: 110.1, GP: 334.4}) {
+		t.Errorf("38X: got %+v %v", c, ok)
+	}
+	for _, f := range []float64{110.1, 334.4} {
+		if c, ok := ByFrequency(f); !ok || c.Name != "38X" {
+			t.Errorf("%g MHz: got %+v %v", f, c, ok)
+		}
+	}
+	for name, vor := range map[string]float64{"17X": 108.0, "59Y": 112.25, "70X": 112.3, "126Y": 117.95} {
+		if c, ok := Lookup(name); !ok || c.VOR != vor || c.LOC != 0 {
+			t.Errorf("%s: got %+v %v, want VOR %g MHz", name, c, ok, vor)
+		}
+	}
+	if _, ok := Lookup("60X"); ok {
+		t.Error("found channel 60X")
+	}
+	if _, ok := ByFrequency(110.12); ok {
+		t.Error("found channel at 110.12 MHz")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range All() {
+		if err := Validate(c); err != nil {
+			t.Errorf("%+v: %v", c, err)
+		}
+	}
+	for _, c := range []Channel{
+		{},
+		{LOC: 110.1},
+		{LOC: 110.1, GP: 334.25},
+		{LOC: 110.0, GP: 334.4},
+		{LOC: 107.9, GP: 334.4},
+		{LOC: 110.1, GP: 340},
+		{VOR: 110.1},
+		{VOR: 118.0},
+	} {
+		if err := Validate(c); err == nil {
+			t.Errorf("%+v: no error", c)
+		} else {
+			t.Logf("%+v: %v", c, err)
+		}
+	}
+}
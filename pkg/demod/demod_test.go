@@ -1,8 +1,13 @@
 package demod
 
 import (
+	"errors"
 	"math"
 	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
 )
 
 func complex128ToIQRawData(iqData []complex128, iqRawData []byte) {
@@ -29,8 +34,12 @@ func TestDemod1(t *testing.T) {
 	n := int(fs / 10)
 	iqData := make([]complex128, n)
 	iqRawData := make([]byte, int(fs/10)<<1)
+	iqSamples := make([]complex64, n)
 	nco := newNCO(channelOffset/fs, n)
-	demodulator := NewDemodulator(channelOffset, n)
+	demodulator, err := NewDemodulator(ils.Config{SampleRate: fs, Offset: channelOffset})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	T := 1 / fs
 	var time float64
@@ -40,7 +49,8 @@ func TestDemod1(t *testing.T) {
 	}
 	mult(iqData, nco, iqData)
 	complex128ToIQRawData(iqData, iqRawData)
-	p, d, s, i := demodulator.Process(iqRawData)
+	iq.DecodeCU8(iqSamples, iqRawData)
+	m, _ := demodulator.Process(iqSamples)
 
 	for i := 0; i < n; i++ {
 		iqData[i] = complex(0, 0.5+0.1*math.Sin(2*math.Pi*90*time)+0.1*math.Sin(2*math.Pi*150*time))
@@ -48,8 +58,9 @@ func TestDemod1(t *testing.T) {
 	}
 	mult(iqData, nco, iqData)
 	complex128ToIQRawData(iqData, iqRawData)
-	p, d, s, i = demodulator.Process(iqRawData)
-	t.Logf("RF:%.1f dBFS; DDM:%.3f%%; SDM:%.3f%%; Ident:%.3f%%\n", p, d, s, i)
+	iq.DecodeCU8(iqSamples, iqRawData)
+	m, _ = demodulator.Process(iqSamples)
+	t.Logf("RF:%.1f dBFS; DDM:%.3f%%; SDM:%.3f%%; Ident:%.3f%%\n", m.RF, m.DDM, m.SDM, m.Ident.Depth)
 }
 
 // Test demod with 0 channel offset
@@ -68,10 +79,15 @@ func TestDemod2(t *testing.T) {
 
 	iqRawData := make([]byte, int(fs/10)<<1)
 	complex128ToIQRawData(iqData, iqRawData)
+	iqSamples := make([]complex64, n)
+	iq.DecodeCU8(iqSamples, iqRawData)
 
-	demodulator := NewDemodulator(channelOffset/fs, n)
-	p, d, s, i := demodulator.Process(iqRawData)
-	t.Logf("RF:%.1f dBFS; DDM:%.3f%%; SDM:%.3f%%; Ident:%.3f%%\n", p, d, s, i)
+	demodulator, err := NewDemodulator(ils.Config{SampleRate: fs, Offset: channelOffset})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := demodulator.Process(iqSamples)
+	t.Logf("RF:%.1f dBFS; DDM:%.3f%%; SDM:%.3f%%; Ident:%.3f%%\n", m.RF, m.DDM, m.SDM, m.Ident.Depth)
 }
 
 func TestDemod3(t *testing.T) {
@@ -81,8 +97,12 @@ func TestDemod3(t *testing.T) {
 	n := int(fs / 10)
 	iqData := make([]complex128, n)
 	iqRawData := make([]byte, int(fs/10)<<1)
+	iqSamples := make([]complex64, n)
 	nco := newNCO(channelOffset/fs+1, n) // add a litte frequency error here so we don't get coherent demod
-	demodulator := NewDemodulator(channelOffset/fs, n)
+	demodulator, err := NewDemodulator(ils.Config{SampleRate: fs, Offset: channelOffset})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	T := 1 / fs
 	var time float64
@@ -92,7 +112,8 @@ func TestDemod3(t *testing.T) {
 	}
 	mult(iqData, nco, iqData)
 	complex128ToIQRawData(iqData, iqRawData)
-	p, d, s, i := demodulator.Process(iqRawData)
+	iq.DecodeCU8(iqSamples, iqRawData)
+	m, _ := demodulator.Process(iqSamples)
 
 	// Generate and process next block
 	for i := 0; i < n; i++ {
@@ -101,26 +122,85 @@ func TestDemod3(t *testing.T) {
 	}
 	mult(iqData, nco, iqData)
 	complex128ToIQRawData(iqData, iqRawData)
-	p, d, s, i = demodulator.Process(iqRawData)
-	t.Logf("RF:%.1f dBFS; DDM:%.3f%%=%.1fµA; SDM:%.3f%%; Ident:%.3f%%\n", p, d, d*150/15.5, s, i)
+	iq.DecodeCU8(iqSamples, iqRawData)
+	m, _ = demodulator.Process(iqSamples)
+	t.Logf("RF:%.1f dBFS; DDM:%.3f%%=%.1fµA; SDM:%.3f%%; Ident:%.3f%%\n", m.RF, m.DDM, m.DDM*150/15.5, m.SDM, m.Ident.Depth)
+}
+
+// Test a 200 ms integration period updated every 50 ms
+func TestDemodOverlap(t *testing.T) {
+	channelOffset := 200.0e3
+	fs := 10.0 * float64(1<<17) // 1310720.0 Hz
+	cfg := ils.Config{SampleRate: fs, Offset: channelOffset, Integration: 200 * time.Millisecond, Overlap: 0.75}
+	n := cfg.BlockSize()
+	iqData := make([]complex128, n)
+	iqRawData := make([]byte, n<<1)
+	iqSamples := make([]complex64, n)
+	demodulator, err := NewDemodulator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	T := 1 / fs
+	var time float64
+	var m ils.Meas
+	for block := 0; block < 4; block++ {
+		for i := 0; i < n; i++ {
+			ph := 2 * math.Pi * channelOffset * time
+			a := 0.5 + 0.1*math.Sin(2*math.Pi*90*time) + 0.12*math.Sin(2*math.Pi*150*time)
+			iqData[i] = complex(a*math.Cos(ph), a*math.Sin(ph))
+			time = time + T
+		}
+		complex128ToIQRawData(iqData, iqRawData)
+		iq.DecodeCU8(iqSamples, iqRawData)
+		m, _ = demodulator.Process(iqSamples)
+	}
+	t.Logf("RF:%.1f dBFS; DDM:%.3f%%; SDM:%.3f%%", m.RF, m.DDM, m.SDM)
+	if math.Abs(float64(m.DDM)-4) > 0.1 || math.Abs(float64(m.SDM)-44) > 0.2 {
+		t.Errorf("DDM %.3f%%, SDM %.3f%%, want 4%% and 44%%", m.DDM, m.SDM)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var cfgErr *ils.ConfigError
+	for _, cfg := range []ils.Config{
+		{SampleRate: 0},
+		{SampleRate: 1e6, Offset: 600e3},
+		{SampleRate: 1e6, Integration: 10 * time.Millisecond},
+		{SampleRate: 1e6, Overlap: 1},
+	} {
+		_, err := NewDemodulator(cfg)
+		if !errors.As(err, &cfgErr) {
+			t.Errorf("%+v: got error %v, want *ils.ConfigError", cfg, err)
+		}
+	}
+
+	demodulator, err := NewDemodulator(ils.Config{SampleRate: 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lenErr *ils.InputLengthError
+	if _, err := demodulator.Process(make([]complex64, 10)); !errors.As(err, &lenErr) {
+		t.Errorf("got error %v, want *ils.InputLengthError", err)
+	}
 }
 
 // go test .\demod  -v
 // or, for CPU usage:
 // go test -benchmem -run=^$ github.com/asgaut/dumpils/demod -bench ^(BenchmarkDemod)$
 
-var carrier, p, d, s, i float64
+var meas ils.Meas
 
 func BenchmarkDemod(b *testing.B) {
 	channelOffset := 200.0e3
 	fs := 10.0 * float64(2<<16) // 1310720.0 Hz
-	iqRawData := make([]byte, int(fs/10)<<1)
-	for i := range iqRawData {
-		iqRawData[i] = 0
+	iqSamples := make([]complex64, int(fs/10))
+	demodulator, err := NewDemodulator(ils.Config{SampleRate: fs, Offset: channelOffset})
+	if err != nil {
+		b.Fatal(err)
 	}
-	demodulator := NewDemodulator(channelOffset/fs, int(fs/10))
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		p, d, s, i = demodulator.Process(iqRawData)
+		meas, _ = demodulator.Process(iqSamples)
 	}
 }
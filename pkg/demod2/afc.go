@@ -0,0 +1,42 @@
+package demod2
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// afcGain is the fraction of the frequency error corrected by each Process call
+const afcGain = 0.5
+
+// carrierOffset returns the frequency of the strongest carrier in the FFT1
+// spectrum relative to the nominal channel frequency in Hz
+func (d *Demodulator) carrierOffset() float64 {
+	n := len(d.FFT1)
+	df := d.fsIn / float64(n)
+	center := int(math.Round(d.tuned / df))
+	span := int(ChannelBandwidth / 2 / df)
+	mag := func(i int) float64 {
+		return cmplx.Abs(d.FFT1[((i%n)+n)%n])
+	}
+	peak := center
+	for i := center - span; i <= center+span; i++ {
+		if mag(i) > mag(peak) {
+			peak = i
+		}
+	}
+	// Parabolic interpolation between the bins
+	f := float64(peak)
+	a, b, c := mag(peak-1), mag(peak), mag(peak+1)
+	if den := a - 2*b + c; den < 0 {
+		f += 0.5 * (a - c) / den
+	}
+	return f*df - d.offset
+}
+
+// afc moves the channel filter towards the channel frequency 'offset' Hz from the nominal
+func (d *Demodulator) afc(offset float64) {
+	tuned := d.tuned + afcGain*(d.offset+offset-d.tuned)
+	if d.dec.Tune(tuned) == nil {
+		d.tuned = tuned
+	}
+}
@@ -0,0 +1,118 @@
+package demod2
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"github.com/asgaut/dumpils/pkg/dsp"
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+const (
+	minSeparation = 3e3  // closest carriers detected as a two-frequency system in Hz
+	carrierRange  = 26.0 // weakest detected second carrier in dB below the strongest carrier
+	carrierSNR    = 20.0 // weakest detected second carrier in dB above the mean spectrum level
+	sepLength     = 255  // taps of the carrier separation filter
+)
+
+// carriers detects a course and a clearance carrier in the analysis window of
+// the channel samples and demodulates each carrier separately. It returns nil
+// if only one carrier is found.
+func (d *Demodulator) carriers() ([]ils.Carrier, float32) {
+	copy(d.FFT3, d.Channel)
+	for i := range d.Channel {
+		d.FFT3[i] *= complex(d.window[i], 0)
+	}
+	for i := len(d.Channel); i < len(d.FFT3); i++ {
+		d.FFT3[i] = 0
+	}
+	d.fft3.Transform(d.FFT3)
+
+	n := len(d.FFT3)
+	freq := func(i int) float64 {
+		if i >= n/2 {
+			i -= n
+		}
+		return float64(i) * d.fs / float64(n)
+	}
+	mag := func(i int) float64 {
+		return cmplx.Abs(d.FFT3[(i+n)%n])
+	}
+
+	// The strongest carrier and the strongest spectral line at least minSeparation away from it
+	first, second := -1, -1
+	var sum float64
+	var bins int
+	for i := 0; i < n; i++ {
+		if math.Abs(freq(i)) > ChannelBandwidth/2 {
+			continue
+		}
+		sum += mag(i)
+		bins++
+		if first < 0 || mag(i) > mag(first) {
+			first = i
+		}
+	}
+	for i := 0; i < n; i++ {
+		if math.Abs(freq(i)) > ChannelBandwidth/2 || math.Abs(freq(i)-freq(first)) < minSeparation {
+			continue
+		}
+		if second < 0 || mag(i) > mag(second) {
+			second = i
+		}
+	}
+	if !(sum > 0) || second < 0 || mag(second) < mag(second-1) || mag(second) < mag(second+1) ||
+		mag(second) < mag(first)*math.Pow(10, -carrierRange/20) ||
+		mag(second) < sum/float64(bins)*math.Pow(10, carrierSNR/20) {
+		return nil, 0
+	}
+
+	// Interpolate the peaks for frequencies between the bins
+	offsets := []float64{freq(first), freq(second)}
+	for j, i := range []int{first, second} {
+		a, b, c := math.Log(mag(i-1)), math.Log(mag(i)), math.Log(mag(i+1))
+		if den := a - 2*b + c; den < 0 {
+			offsets[j] += 0.5 * (a - c) / den * d.fs / float64(n)
+		}
+	}
+	sort.Float64s(offsets)
+	separation := offsets[1] - offsets[0]
+
+	taps := dsp.LowpassTaps(sepLength, separation/2/d.fs)
+	carriers := make([]ils.Carrier, len(offsets))
+	for j, f := range offsets {
+		carriers[j] = d.demodulateCarrier(f, taps)
+	}
+	return carriers, float32(separation)
+}
+
+// demodulateCarrier mixes the carrier at 'offset' Hz in the channel samples
+// down to zero frequency, removes the other carrier with the lowpass filter
+// 'taps' and measures the navigation tones of the carrier
+func (d *Demodulator) demodulateCarrier(offset float64, taps []float64) ils.Carrier {
+	rot := complex128(1)
+	step := cmplx.Exp(complex(0, -2*math.Pi*offset/d.fs))
+	for i, v := range d.Channel {
+		d.mixed[i] = v * rot
+		rot *= step
+	}
+	for i := range d.carrier {
+		var sum complex128
+		for k, t := range taps {
+			sum += d.mixed[i+k] * complex(t, 0)
+		}
+		d.carrier[i] = complex(cmplx.Abs(sum), 0)
+	}
+
+	m := float64(len(d.carrier))
+	level := cmplx.Abs(dsp.DFT(d.carrier, d.carrierWindow, 0))
+	var c ils.Carrier
+	c.Offset = float32(offset + d.tuned - d.offset) // relative to the nominal channel frequency
+	c.Mod150 = ils.Depth(cmplx.Abs(dsp.DFT(d.carrier, d.carrierWindow, ils.Tone150*m/d.fs)), level)
+	c.Mod90 = ils.Depth(cmplx.Abs(dsp.DFT(d.carrier, d.carrierWindow, ils.Tone90*m/d.fs)), level)
+	c.DDM = c.Mod150 - c.Mod90
+	c.SDM = c.Mod150 + c.Mod90
+	c.RF = ils.DBFS(level / (0.5 * m))
+	return c
+}
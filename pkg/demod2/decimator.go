@@ -0,0 +1,163 @@
+package demod2
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/asgaut/dumpils/pkg/dsp"
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+const (
+	// MinOutputRate is the lowest sample rate the Decimator decimates to
+	MinOutputRate = 50e3
+	// ChannelBandwidth is the bandwidth passed by the Decimator
+	ChannelBandwidth = 25e3
+
+	cicOrder  = 4
+	cicScale  = 1 << 24 // fixed point scaling of the CIC input
+	firLength = 63
+)
+
+// Decimator mixes a channel down to zero frequency and reduces the sample rate.
+//
+// The decimation is done in two stages. A fixed point CIC filter decimates to
+// twice the output rate, followed by a lowpass FIR filter which removes
+// everything outside the channel bandwidth and decimates by two.
+// The total decimation factor is the largest power of two which keeps the
+// output rate at or above MinOutputRate.
+type Decimator struct {
+	outRate    float64
+	cicFactor  int
+	firFactor  int
+	rot, step  complex128 // NCO state
+	integrator [cicOrder][2]int64
+	comb       [cicOrder][2]int64
+	cicCount   int
+	cicGain    float64
+	taps       []float64
+	history    []complex128 // FIR delay line, twice the FIR length
+	historyPos int
+	firCount   int
+}
+
+// NewDecimator creates a Decimator for a channel at 'offset' Hz from the
+// center of an input sampled at 'fs' Hz. The returned error is a *ils.ConfigError.
+func NewDecimator(fs, offset float64) (*Decimator, error) {
+	if !(fs >= MinOutputRate) {
+		return nil, &ils.ConfigError{Field: "SampleRate", Value: fs,
+			Reason: fmt.Sprintf("must be at least %.0f Hz", MinOutputRate)}
+	}
+	if !(math.Abs(offset)+ChannelBandwidth/2 <= fs/2) {
+		return nil, &ils.ConfigError{Field: "Offset", Value: offset,
+			Reason: fmt.Sprintf("the %.0f Hz wide channel must be within ±%.0f Hz at sample rate %.0f Hz", ChannelBandwidth, fs/2, fs)}
+	}
+	factor := 1
+	for fs/float64(2*factor) >= MinOutputRate {
+		factor *= 2
+	}
+	d := &Decimator{
+		outRate:   fs / float64(factor),
+		cicFactor: 1,
+		firFactor: 1,
+		rot:       1,
+		step:      cmplx.Exp(complex(0, -2*math.Pi*offset/fs)),
+		history:   make([]complex128, 2*firLength),
+	}
+	if factor > 1 {
+		d.cicFactor = factor / 2
+		d.firFactor = 2
+	}
+	d.cicGain = math.Pow(float64(d.cicFactor), cicOrder) * cicScale
+	d.taps = dsp.LowpassTaps(firLength, ChannelBandwidth/2/(d.outRate*float64(d.firFactor)))
+	return d, nil
+}
+
+// Tune moves the channel to 'offset' Hz from the center of the input.
+// The filter states are kept. The returned error is a *ils.ConfigError.
+func (d *Decimator) Tune(offset float64) error {
+	fs := d.outRate * float64(d.Factor()) // input sample rate
+	if !(math.Abs(offset)+ChannelBandwidth/2 <= fs/2) {
+		return &ils.ConfigError{Field: "Offset", Value: offset,
+			Reason: fmt.Sprintf("the %.0f Hz wide channel must be within ±%.0f Hz at sample rate %.0f Hz", ChannelBandwidth, fs/2, fs)}
+	}
+	d.step = cmplx.Exp(complex(0, -2*math.Pi*offset/fs))
+	return nil
+}
+
+// OutputRate returns the sample rate of the decimated signal in Hz
+func (d *Decimator) OutputRate() float64 {
+	return d.outRate
+}
+
+// Factor returns the total decimation factor
+func (d *Decimator) Factor() int {
+	return d.cicFactor * d.firFactor
+}
+
+// Gain returns the amplitude response of the Decimator at 'f' Hz from the channel center
+func (d *Decimator) Gain(f float64) float64 {
+	fs := d.outRate * float64(d.Factor()) // input sample rate
+	g := 1.0
+	if x := math.Pi * f / fs; d.cicFactor > 1 && x != 0 {
+		g = math.Pow(math.Abs(math.Sin(x*float64(d.cicFactor))/(float64(d.cicFactor)*math.Sin(x))), cicOrder)
+	}
+	var sum complex128
+	for i, t := range d.taps {
+		sum += complex(t, 0) * cmplx.Exp(complex(0, -2*math.Pi*f*float64(i)*float64(d.cicFactor)/fs))
+	}
+	return g * cmplx.Abs(sum)
+}
+
+// Process decimates 'in' and writes the result to 'out', which must hold
+// at least len(in)/Factor()+1 samples. It returns the number of samples written.
+// The filter states are kept, so successive calls process a continuous signal.
+func (d *Decimator) Process(in []complex128, out []complex128) int {
+	n := 0
+	for _, x := range in {
+		x *= d.rot
+		d.rot *= d.step
+
+		// CIC integrators run at the input rate. Overflow wraps around,
+		// which the combs undo as long as the output fits in an int64.
+		v := [2]int64{int64(real(x) * cicScale), int64(imag(x) * cicScale)}
+		for s := range d.integrator {
+			for c := range v {
+				d.integrator[s][c] += v[c]
+				v[c] = d.integrator[s][c]
+			}
+		}
+		d.cicCount++
+		if d.cicCount < d.cicFactor {
+			continue
+		}
+		d.cicCount = 0
+		// CIC combs run at the decimated rate
+		for s := range d.comb {
+			for c := range v {
+				v[c], d.comb[s][c] = v[c]-d.comb[s][c], v[c]
+			}
+		}
+		y := complex(float64(v[0])/d.cicGain, float64(v[1])/d.cicGain)
+
+		// The FIR delay line is stored twice so the taps can be applied to a contiguous slice
+		d.history[d.historyPos] = y
+		d.history[d.historyPos+firLength] = y
+		d.historyPos = (d.historyPos + 1) % firLength
+		d.firCount++
+		if d.firCount < d.firFactor {
+			continue
+		}
+		d.firCount = 0
+		var sum complex128
+		h := d.history[d.historyPos : d.historyPos+firLength]
+		for i, t := range d.taps {
+			sum += h[i] * complex(t, 0)
+		}
+		out[n] = sum
+		n++
+	}
+	d.rot /= complex(cmplx.Abs(d.rot), 0) // avoid accumulating rounding errors
+	return n
+}
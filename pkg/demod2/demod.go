@@ -1,21 +1,20 @@
 package demod2
 
 import (
-	"log"
+	"fmt"
 	"math"
 	"math/cmplx"
 
+	"github.com/asgaut/dumpils/pkg/dsp"
+	"github.com/asgaut/dumpils/pkg/ident"
+	"github.com/asgaut/dumpils/pkg/ils"
 	"github.com/ktye/fft"
 )
 
-func iqToComplex128(input []byte, output []complex128) {
-	i := 0
-	for idx := range output {
-		output[idx] = complex(float64(input[i]), float64(input[i+1]))
-		output[idx] /= 127.5
-		output[idx] -= (1 + 1i)
-		i += 2
-	}
+func init() {
+	ils.Register("demod2", func(cfg ils.Config) (ils.Demodulator, error) {
+		return NewDemodulator(cfg)
+	})
 }
 
 // mult calculates p = f1 * f2. The slices must be
@@ -33,109 +32,156 @@ func abs(in []complex128, out []complex128) {
 	}
 }
 
-// downsample throws away (len(in)/len(out))-1 input samples per output sample
-func downsample(in, out []complex128) {
-	n := len(in) / len(out)
-	for i := range out {
-		out[i] = in[i*n]
-	}
-}
-
 // Demodulator contains preallocated buffers and cached data for the demodulator
 type Demodulator struct {
-	n          int
-	fft1, fft2 fft.FFT
-	fs         float64
-	Zero       []complex128
-	FFT1       []complex128
-	IFFT       []complex128
-	LF         []complex128
-	Envelope   []complex128
-	FFT2       []complex128
-	Meas       Meas
+	n                int // input samples per Process call
+	fsIn, fs         float64
+	offset           float64 // nominal channel frequency relative to the center of the input in Hz
+	tuned            float64 // channel frequency of the Decimator in Hz
+	tracking         bool    // AFC enabled
+	fft1, fft2, fft3 fft.FFT
+	bin90, bin150    float64
+	dec              *Decimator
+	IQ               []complex128 // input samples of the latest Process call
+	FFT1             []complex128
+	LF               []complex128 // decimated channel samples of the latest Process call
+	Channel          []complex128 // analysis window of the decimated channel samples
+	FFT3             []complex128
+	Envelope         []complex128 // analysis window of the demodulated AM signal
+	FFT2             []complex128
+	window           []float64
+	prev90, prev150  complex128   // tone DFT bins of the previous Process call
+	mixed            []complex128 // channel samples mixed down to one carrier
+	carrier          []complex128 // demodulated AM signal of one carrier
+	carrierWindow    []float64
+	Meas             Meas
+	ident            *ident.Decoder
 }
 
-// Meas holds the demodulated data
-type Meas struct {
-	Mod150 float32 `json:"mod150"`
-	Mod90  float32 `json:"mod90"`
-	DDM    float32 `json:"ddm"`
-	SDM    float32 `json:"sdm"`
-	RF     float32 `json:"rf"`
-}
+// Meas holds the demodulated data. It is an alias of the type shared by all ILS demodulators.
+type Meas = ils.Meas
 
-// NewDemodulator creates a Demodulator
-func NewDemodulator(fs float64, numSamples int) *Demodulator {
-	f1, err := fft.New(numSamples)
+// NewDemodulator creates a Demodulator. The input may have any sample rate
+// supported by the Decimator and the channel may be anywhere in the input band.
+// The returned error is a *ils.ConfigError if the Config is invalid.
+func NewDemodulator(cfg ils.Config) (*Demodulator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	dec, err := NewDecimator(cfg.SampleRate, cfg.Offset)
 	if err != nil {
-		log.Fatal("Error init FFT1:", err)
+		return nil, err
 	}
-	f2, err := fft.New(numSamples / 16)
+	numSamples := cfg.BlockSize()
+	windowSize := int(math.Round(dec.OutputRate() * cfg.Period().Seconds()))
+	f1, err := fft.New(dsp.NextPow2(numSamples))
 	if err != nil {
-		log.Fatal("Error init FFT2:", err)
+		return nil, fmt.Errorf("error init FFT1: %v", err)
 	}
-	return &Demodulator{
-		//iqData:   make([]complex128, numSamples),
-		Zero:     make([]complex128, numSamples),
-		FFT1:     make([]complex128, numSamples),
-		IFFT:     make([]complex128, numSamples),
-		LF:       make([]complex128, numSamples/16),
-		Envelope: make([]complex128, numSamples/16),
-		FFT2:     make([]complex128, numSamples/16),
-		fft1:     f1,
-		fft2:     f2,
-		n:        numSamples,
-		fs:       fs,
+	f2, err := fft.New(dsp.NextPow2(windowSize))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT2: %v", err)
+	}
+	f3, err := fft.New(dsp.NextPow2(windowSize))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT3: %v", err)
 	}
+	carrierSize := windowSize - sepLength + 1 // the filtered samples which depend only on the window
+	return &Demodulator{
+		IQ:            make([]complex128, numSamples),
+		FFT1:          make([]complex128, f1.N),
+		LF:            make([]complex128, numSamples/dec.Factor()+1),
+		Channel:       make([]complex128, windowSize),
+		FFT3:          make([]complex128, f3.N),
+		Envelope:      make([]complex128, windowSize),
+		FFT2:          make([]complex128, f2.N),
+		window:        dsp.Hann(windowSize),
+		mixed:         make([]complex128, windowSize),
+		carrier:       make([]complex128, carrierSize),
+		carrierWindow: dsp.Hann(carrierSize),
+		fft1:          f1,
+		fft2:          f2,
+		fft3:          f3,
+		n:             numSamples,
+		fsIn:          cfg.SampleRate,
+		fs:            dec.OutputRate(),
+		offset:        cfg.Offset,
+		tuned:         cfg.Offset,
+		tracking:      cfg.AFC,
+		dec:           dec,
+		bin90:         cfg.Bin(ils.Tone90),
+		bin150:        cfg.Bin(ils.Tone150),
+		ident:         ident.NewDecoder(dec.OutputRate()),
+	}, nil
 }
 
-// Spectrum1 returns the amplitude spectrum before bandpass filtering
+// Spectrum1 returns the amplitude spectrum of the input samples
 func (d *Demodulator) Spectrum1() []float32 {
-	s := make([]float32, d.n)
+	s := make([]float32, len(d.FFT1))
 	for i := range s {
 		s[i] = float32(cmplx.Abs(d.FFT1[i]) / float64(d.n))
 	}
 	return s
 }
 
-// Spectrum2 returns the amplitude spectrum after bandpass filtering
+// Spectrum2 returns the amplitude spectrum of the demodulated AM signal
 func (d *Demodulator) Spectrum2() []float32 {
-	s := make([]float32, len(d.FFT2))
-	for i := range s {
-		s[i] = float32(cmplx.Abs(d.FFT2[i]) / float64(len(d.FFT2)))
-	}
-	return s
+	return dsp.Spectrum(d.fft2, d.Envelope, d.FFT2)
 }
 
 // Process input samples and calculate ILS measurements.
-func (d *Demodulator) Process(input []byte) {
-	iqToComplex128(input, d.FFT1)
+// The 'iq' slice holds the samples following the previous call to Process.
+func (d *Demodulator) Process(iq []complex64) (Meas, error) {
+	if len(iq) != d.n {
+		return d.Meas, &ils.InputLengthError{Got: len(iq), Want: d.n}
+	}
+	dsp.ToComplex128(iq, d.IQ)
 
-	// Bandpass filter using FFT and inverse FFT
-	// https://dsp.stackexchange.com/questions/6220/why-is-it-a-bad-idea-to-filter-by-zeroing-out-fft-bins
-	// (our signals of interest are integer periodic in the FFT width)
+	// Spectrum of the input for display
+	copy(d.FFT1, d.IQ)
+	for i := d.n; i < len(d.FFT1); i++ {
+		d.FFT1[i] = 0
+	}
 	d.fft1.Transform(d.FFT1)
-	binFreqWidth := d.fs / float64(d.n)
-	passLow, passHigh := int((200e3-10e3)/binFreqWidth), int((200e3+10e3)/binFreqWidth)
-	copy(d.IFFT[0:passLow], d.Zero[0:passLow])
-	copy(d.IFFT[passLow:passHigh+1], d.FFT1[passLow:passHigh])
-	copy(d.IFFT[passHigh+1:], d.Zero[passHigh+1:])
-	d.fft1.Inverse(d.IFFT)
-
-	// Downsample and demodulate the AM signal
-	downsample(d.IFFT, d.LF)
-	abs(d.LF, d.Envelope)
-
-	// FFT to calculate the modulation levels of the navigation tones
-	copy(d.FFT2, d.Envelope)
-	s := d.fft2.Transform(d.FFT2)
-
-	carrier := cmplx.Abs(s[0])
-	d.Meas.Mod150 = float32((cmplx.Abs(s[15]) + cmplx.Abs(s[len(s)-15])) / carrier * 100)
-	d.Meas.Mod90 = float32((cmplx.Abs(s[9]) + cmplx.Abs(s[len(s)-9])) / carrier * 100)
+	d.Meas.Offset = float32(d.carrierOffset())
+
+	// Select the channel, demodulate the AM signal and slide the analysis window
+	n := d.dec.Process(d.IQ, d.LF)
+	lf := d.LF[:n]
+	if n > len(d.Envelope) {
+		lf = lf[n-len(d.Envelope):]
+	}
+	copy(d.Channel, d.Channel[len(lf):])
+	copy(d.Channel[len(d.Channel)-len(lf):], lf)
+	copy(d.Envelope, d.Envelope[len(lf):])
+	newEnvelope := d.Envelope[len(d.Envelope)-len(lf):]
+	abs(lf, newEnvelope)
+	d.ident.Process(newEnvelope)
+
+	// Windowed DFT to calculate the modulation levels of the navigation tones.
+	// The window scales all bins equally, so the modulation depths are the ratios
+	// of the tone bins to the DC bin, counting both the positive and negative frequency.
+	carrier := cmplx.Abs(dsp.DFT(d.Envelope, d.window, 0))
+	x150 := dsp.DFT(d.Envelope, d.window, d.bin150)
+	x90 := dsp.DFT(d.Envelope, d.window, d.bin90)
+	d.Meas.Mod150 = ils.Depth(cmplx.Abs(x150), carrier)
+	d.Meas.Mod90 = ils.Depth(cmplx.Abs(x90), carrier)
 	d.Meas.DDM = (d.Meas.Mod150 - d.Meas.Mod90) // 150 Hz dominance (DDM > 0): Fly UP/LEFT
 	d.Meas.SDM = (d.Meas.Mod150 + d.Meas.Mod90)
-	//ident = (cmplx.Abs(s[102]) + cmplx.Abs(s[len(s)-102])) / carrier * 100
-	carrier = carrier / float64(len(s))
-	d.Meas.RF = float32(20 * math.Log10(carrier)) // Carrier power in dBFS
+	d.Meas.Ident = d.ident.Ident()
+	carrier = carrier / (0.5 * float64(len(d.Envelope))) // Coherent gain of the Hann window is 0.5
+	d.Meas.RF = ils.DBFS(carrier)                        // Carrier power in dBFS
+	d.tones(x90, x150, n)
+
+	// Separate measurements of the course and clearance carriers of two-frequency systems
+	d.Meas.Carriers, d.Meas.Separation = d.carriers()
+
+	if d.tracking {
+		offset := float64(d.Meas.Offset)
+		if len(d.Meas.Carriers) == 2 {
+			offset = float64(d.Meas.Carriers[0].Offset+d.Meas.Carriers[1].Offset) / 2
+		}
+		d.afc(offset)
+	}
+	return d.Meas, nil
 }
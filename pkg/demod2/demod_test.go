@@ -0,0 +1,243 @@
+package demod2
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/siggen"
+)
+
+// generator returns a generator of the carrier 'c' with the channel 'offset' Hz from the center frequency
+func generator(t *testing.T, fs, offset float64, c siggen.Carrier) *siggen.Generator {
+	g, err := siggen.New(fs, offset, siggen.Params{Carrier: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestSampleRates(t *testing.T) {
+	tests := []struct {
+		fs, offset float64
+	}{
+		{10.0 * float64(1<<17), 200e3},
+		{1.024e6, 250e3},
+		{2.048e6, -300e3},
+		{2.4e6, 0},
+		{250e3, 100e3},
+	}
+	for _, tc := range tests {
+		cfg := ils.Config{SampleRate: tc.fs, Offset: tc.offset}
+		d, err := NewDemodulator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m Meas
+		g := generator(t, tc.fs, tc.offset, siggen.Carrier{DDM: 2, SDM: 42, RF: -6.02})
+		iq := make([]complex64, cfg.BlockSize())
+		for block := 0; block < 3; block++ {
+			g.Generate(iq)
+			m, err = d.Process(iq)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Logf("fs=%.0f offset=%.0f decimation=%d: RF:%.2f dBFS; DDM:%.3f%%; SDM:%.3f%%", tc.fs, tc.offset, d.dec.Factor(), m.RF, m.DDM, m.SDM)
+		if math.Abs(float64(m.DDM)-2) > 0.05 || math.Abs(float64(m.SDM)-42) > 0.2 || math.Abs(float64(m.RF)+6.02) > 0.2 {
+			t.Errorf("fs=%.0f offset=%.0f: DDM %.3f%%, SDM %.3f%%, RF %.2f dBFS, want 2%%, 42%% and -6.02 dBFS",
+				tc.fs, tc.offset, m.DDM, m.SDM, m.RF)
+		}
+	}
+}
+
+func TestTwoCarriers(t *testing.T) {
+	fs := 10.0 * float64(1<<17)
+	offset := 200e3
+	cfg := ils.Config{SampleRate: fs, Offset: offset}
+	d, err := NewDemodulator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Course carrier 4 kHz above and clearance carrier 4 kHz below the channel frequency
+	g, err := siggen.New(fs, offset, siggen.Params{
+		Carrier: siggen.Carrier{SDM: 40, RF: -10.46, Offset: 4e3},
+		Second:  &siggen.Carrier{DDM: -20, SDM: 40, RF: -20, Offset: -4e3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iq := make([]complex64, cfg.BlockSize())
+	var m Meas
+	for block := 0; block < 3; block++ {
+		g.Generate(iq)
+		m, err = d.Process(iq)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("separation %.1f Hz: %+v", m.Separation, m.Carriers)
+	if len(m.Carriers) != 2 {
+		t.Fatalf("got %d carriers, want 2", len(m.Carriers))
+	}
+	if math.Abs(float64(m.Separation)-8e3) > 5 {
+		t.Errorf("separation %.1f Hz, want 8000 Hz", m.Separation)
+	}
+	want := []ils.Carrier{
+		{Offset: -4e3, DDM: -20, SDM: 40, RF: -20},
+		{Offset: 4e3, DDM: 0, SDM: 40, RF: -10.46},
+	}
+	for i, c := range m.Carriers {
+		w := want[i]
+		if math.Abs(float64(c.Offset-w.Offset)) > 5 || math.Abs(float64(c.DDM-w.DDM)) > 0.2 ||
+			math.Abs(float64(c.SDM-w.SDM)) > 0.4 || math.Abs(float64(c.RF-w.RF)) > 0.2 {
+			t.Errorf("carrier %d: %+v, want %+v", i, c, w)
+		}
+	}
+
+	// A single carrier is not reported as a two-frequency system
+	g = generator(t, fs, offset, siggen.Carrier{SDM: 40, RF: -6})
+	for block := 0; block < 2; block++ {
+		g.Generate(iq)
+		m, _ = d.Process(iq)
+	}
+	if m.Carriers != nil {
+		t.Errorf("got carriers %+v from a single carrier", m.Carriers)
+	}
+}
+
+func TestCarrierOffset(t *testing.T) {
+	tests := []struct {
+		fs, offset, err float64
+	}{
+		{10.0 * float64(1<<17), 200e3, 0},
+		{10.0 * float64(1<<17), 200e3, 37.5},
+		{1.024e6, 250e3, -123.4},
+		{2.4e6, 0, 4321},
+	}
+	for _, tc := range tests {
+		cfg := ils.Config{SampleRate: tc.fs, Offset: tc.offset}
+		d, err := NewDemodulator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iq := make([]complex64, cfg.BlockSize())
+		generator(t, tc.fs, tc.offset, siggen.Carrier{SDM: 40, RF: -6, Offset: tc.err}).Generate(iq)
+		m, err := d.Process(iq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("fs=%.0f: carrier offset %.2f Hz, want %.2f Hz", tc.fs, m.Offset, tc.err)
+		if math.Abs(float64(m.Offset)-tc.err) > 5 {
+			t.Errorf("fs=%.0f: carrier offset %.2f Hz, want %.2f Hz", tc.fs, m.Offset, tc.err)
+		}
+	}
+}
+
+func TestAFC(t *testing.T) {
+	fs := 10.0 * float64(1<<17)
+	offset := 200e3
+	drift := 9e3 // e.g. 80 ppm at 110 MHz
+	cfg := ils.Config{SampleRate: fs, Offset: offset, AFC: true}
+	d, err := NewDemodulator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Meas
+	g := generator(t, fs, offset, siggen.Carrier{DDM: 2, SDM: 42, RF: -6, Offset: drift})
+	iq := make([]complex64, cfg.BlockSize())
+	for block := 0; block < 20; block++ {
+		g.Generate(iq)
+		m, err = d.Process(iq)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("tuned %.1f Hz: carrier offset %.2f Hz; DDM:%.3f%%; SDM:%.3f%%", d.tuned, m.Offset, m.DDM, m.SDM)
+	if math.Abs(d.tuned-offset-drift) > 5 || math.Abs(float64(m.Offset)-drift) > 5 {
+		t.Errorf("channel tuned to %.1f Hz with carrier offset %.2f Hz, want %.1f Hz and %.2f Hz", d.tuned, m.Offset, offset+drift, drift)
+	}
+	if math.Abs(float64(m.DDM)-2) > 0.05 || math.Abs(float64(m.SDM)-42) > 0.2 {
+		t.Errorf("DDM %.3f%%, SDM %.3f%%, want 2%% and 42%%", m.DDM, m.SDM)
+	}
+}
+
+func TestTones(t *testing.T) {
+	fs := 10.0 * float64(1<<17)
+	offset := 200e3
+	tests := []struct {
+		phase, f90, f150, thd90, thd150 float64
+	}{
+		{0, 90, 150, 0, 0},
+		{15, 90, 150, 5, 0},
+		{-40, 90, 150, 0, 8},
+		{0, 90.5, 150, 0, 0},
+		{0, 89.2, 151, 0, 0},
+	}
+	for _, tc := range tests {
+		cfg := ils.Config{SampleRate: fs, Offset: offset}
+		d, err := NewDemodulator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := cfg.BlockSize()
+		iq := make([]complex64, n)
+		var m Meas
+		for block := 0; block < 4; block++ {
+			for i := range iq {
+				tm := float64(block*n+i) / fs
+				a := 0.5 * (1 + 0.2*math.Sin(2*math.Pi*tc.f90*tm) + 0.2*math.Sin(2*math.Pi*tc.f150*tm+tc.phase*math.Pi/180) +
+					0.2*tc.thd90/100*math.Sin(2*math.Pi*2*tc.f90*tm) + 0.2*tc.thd150/100*math.Sin(2*math.Pi*3*tc.f150*tm))
+				ph := 2 * math.Pi * offset * tm
+				iq[i] = complex64(complex(a*math.Cos(ph), a*math.Sin(ph)))
+			}
+			m, err = d.Process(iq)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Logf("phase %.2f°; 90 Hz: %.3f Hz, %.2f%%; 150 Hz: %.3f Hz, %.2f%%", m.Phase, m.Freq90, m.THD90, m.Freq150, m.THD150)
+		// The phase difference drifts and the tones leak into the harmonic bins unless the tones are exact
+		locked := tc.f90 == 90 && tc.f150 == 150
+		if math.Abs(float64(m.Freq90)-tc.f90) > 0.05 || math.Abs(float64(m.Freq150)-tc.f150) > 0.05 ||
+			(locked && (math.Abs(float64(m.Phase)-tc.phase) > 1 ||
+				math.Abs(float64(m.THD90)-tc.thd90) > 0.3 || math.Abs(float64(m.THD150)-tc.thd150) > 0.3)) {
+			t.Errorf("got phase %.2f°, tones %.3f/%.3f Hz and harmonics %.2f/%.2f%%, want %+v",
+				m.Phase, m.Freq90, m.Freq150, m.THD90, m.THD150, tc)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []ils.Config{
+		{SampleRate: 10e3, Offset: 0},
+		{SampleRate: 1.024e6, Offset: 600e3},
+		{SampleRate: 2.4e6, Offset: -1.2e6},
+	} {
+		if _, err := NewDemodulator(cfg); err == nil {
+			t.Errorf("no error for sample rate %.0f Hz and offset %.0f Hz", cfg.SampleRate, cfg.Offset)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+// TestNoSignal checks that the measurements of silence can be encoded as JSON
+func TestNoSignal(t *testing.T) {
+	cfg := ils.Config{SampleRate: 1.024e6, Offset: 250e3}
+	d, err := NewDemodulator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Meas
+	for block := 0; block < 2; block++ {
+		if m, err = d.Process(make([]complex64, cfg.BlockSize())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := json.Marshal(m); err != nil || m.RF != ils.NoSignal {
+		t.Errorf("RF %.1f dBFS, want %.1f dBFS: %v", m.RF, ils.NoSignal, err)
+	}
+}
@@ -0,0 +1,60 @@
+package demod2
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/asgaut/dumpils/pkg/dsp"
+)
+
+// harmonics is the highest harmonic of the navigation tones included in the harmonic content
+const harmonics = 4
+
+// wrap returns the angle 'a' in the range -period/2 < a <= period/2
+func wrap(a, period float64) float64 {
+	a = math.Mod(a, period)
+	if a > period/2 {
+		a -= period
+	} else if a <= -period/2 {
+		a += period
+	}
+	return a
+}
+
+// tones measures the phase, frequency and harmonic content of the navigation
+// tones from their DFT bins 'x90' and 'x150' after the analysis window
+// has moved 'shift' decimated samples
+func (d *Demodulator) tones(x90, x150 complex128, shift int) {
+	// The tones pass through zero in the same direction when the 150 Hz phase
+	// is 5/3 of the 90 Hz phase. Every third 90 Hz period is the same, so the
+	// phase difference in degrees of the 150 Hz tone is ambiguous modulo 120°.
+	phase := cmplx.Phase(x150) - 5.0/3*cmplx.Phase(x90) - math.Pi/3
+	d.Meas.Phase = float32(wrap(phase*180/math.Pi, 120))
+
+	// The phase at the start of the window moves with the exact tone frequency
+	dt := float64(shift) / d.fs
+	frequency := func(x, prev complex128, bin float64) float32 {
+		if prev == 0 || x == 0 {
+			return 0
+		}
+		f := bin * d.fs / float64(len(d.Envelope))
+		return float32(f + wrap(cmplx.Phase(x/prev)-2*math.Pi*f*dt, 2*math.Pi)/(2*math.Pi*dt))
+	}
+	d.Meas.Freq90 = frequency(x90, d.prev90, d.bin90)
+	d.Meas.Freq150 = frequency(x150, d.prev150, d.bin150)
+	d.prev90, d.prev150 = x90, x150
+
+	thd := func(x complex128, bin float64) float32 {
+		if x == 0 {
+			return 0
+		}
+		var sum float64
+		for k := 2; k <= harmonics; k++ {
+			h := cmplx.Abs(dsp.DFT(d.Envelope, d.window, float64(k)*bin))
+			sum += h * h
+		}
+		return float32(math.Sqrt(sum) / cmplx.Abs(x) * 100)
+	}
+	d.Meas.THD90 = thd(x90, d.bin90)
+	d.Meas.THD150 = thd(x150, d.bin150)
+}
@@ -0,0 +1,82 @@
+// Package dsp holds the signal processing functions shared by the receivers
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/ktye/fft"
+)
+
+// ToComplex128 widens the input samples to complex128
+func ToComplex128(input []complex64, output []complex128) {
+	for idx := range output {
+		output[idx] = complex128(input[idx])
+	}
+}
+
+// Hann returns a Hann window of length 'n'
+func Hann(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	return w
+}
+
+// DFT calculates the windowed DFT of 'x' at the (possibly fractional) bin 'k'
+func DFT(x []complex128, window []float64, k float64) complex128 {
+	var sum complex128
+	rot := complex128(1)
+	step := cmplx.Exp(complex(0, -2*math.Pi*k/float64(len(x))))
+	for i := range x {
+		sum += x[i] * complex(window[i], 0) * rot
+		rot *= step
+	}
+	return sum
+}
+
+// NextPow2 returns the smallest power of 2 which is >= n
+func NextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// LowpassTaps returns a Blackman windowed sinc lowpass filter with cutoff
+// frequency 'fc' relative to the sample rate
+func LowpassTaps(n int, fc float64) []float64 {
+	taps := make([]float64, n)
+	var sum float64
+	for i := range taps {
+		x := float64(i) - float64(n-1)/2
+		sinc := 2 * fc
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		taps[i] = sinc * w
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum // unity gain at DC
+	}
+	return taps
+}
+
+// Spectrum returns the amplitude spectrum of 'x', zero padded to the length
+// of the FFT 'f'. 'buf' must hold f.N samples.
+func Spectrum(f fft.FFT, x, buf []complex128) []float32 {
+	copy(buf, x)
+	for i := len(x); i < len(buf); i++ {
+		buf[i] = 0
+	}
+	f.Transform(buf)
+	s := make([]float32, len(buf))
+	for i := range s {
+		s[i] = float32(cmplx.Abs(buf[i]) / float64(len(x)))
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/ktye/fft"
+)
+
+func TestNextPow2(t *testing.T) {
+	for _, c := range []struct{ n, want int }{{1, 1}, {2, 2}, {3, 4}, {1000, 1024}, {1024, 1024}} {
+		if got := NextPow2(c.n); got != c.want {
+			t.Errorf("NextPow2(%d) = %d, want %d", c.n, got, c.want)
+		}
+	}
+}
+
+func TestDFT(t *testing.T) {
+	// A tone of amplitude 0.5 at bin 10.5, between two FFT bins
+	n := 1000
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(0.5, 0) * cmplx.Exp(complex(0, 2*math.Pi*10.5*float64(i)/float64(n)))
+	}
+	w := Hann(n)
+	// Coherent gain of the Hann window is 0.5
+	if a := cmplx.Abs(DFT(x, w, 10.5)) / (0.5 * float64(n)); math.Abs(a-0.5) > 1e-9 {
+		t.Errorf("amplitude %g at the tone, want 0.5", a)
+	}
+	if a := cmplx.Abs(DFT(x, w, 20)) / (0.5 * float64(n)); a > 1e-3 {
+		t.Errorf("amplitude %g away from the tone", a)
+	}
+}
+
+func TestLowpassTaps(t *testing.T) {
+	taps := LowpassTaps(63, 0.1)
+	gain := func(f float64) float64 {
+		var sum complex128
+		for i, h := range taps {
+			sum += complex(h, 0) * cmplx.Exp(complex(0, -2*math.Pi*f*float64(i)))
+		}
+		return cmplx.Abs(sum)
+	}
+	if g := gain(0); math.Abs(g-1) > 1e-12 {
+		t.Errorf("DC gain %g, want 1", g)
+	}
+	if g := gain(0.2); g > 1e-3 {
+		t.Errorf("stop band gain %g", g)
+	}
+}
+
+func TestSpectrum(t *testing.T) {
+	f, err := fft.New(NextPow2(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := make([]complex128, 100)
+	for i := range x {
+		x[i] = 2
+	}
+	buf := make([]complex128, f.N)
+	buf[f.N-1] = 1 // stale samples are cleared
+	s := Spectrum(f, x, buf)
+	if len(s) != f.N || math.Abs(float64(s[0])-2) > 1e-6 {
+		t.Errorf("%d bins, DC %g, want %d bins, DC 2", len(s), s[0], f.N)
+	}
+}
@@ -0,0 +1,200 @@
+// Package ident decodes the Morse coded station identifier keyed on the
+// 1020 Hz ident tone of ILS and VOR transmitters.
+package ident
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Tone is the frequency of the ident tone in Hz
+const Tone = 1020.0
+
+const (
+	tick        = 0.005 // seconds between keying decisions
+	smoothing   = 0.003 // time constant of the tone detector in seconds
+	averaging   = 0.02  // time constant of the envelope mean in seconds
+	peakDecay   = 20.0  // time constant of the keyed level tracker in seconds
+	floorRise   = 5.0   // time constant of the unkeyed level tracker in seconds
+	minContrast = 1.0   // minimum keyed/unkeyed level difference in percent
+)
+
+// Ident holds the decoded identifier and the keying timing
+type Ident struct {
+	Text  string  `json:"text"`  // Last complete identifier
+	Depth float32 `json:"depth"` // Modulation depth of the keyed tone in percent
+	WPM   float32 `json:"wpm"`   // Keying speed in words per minute
+	Dot   float32 `json:"dot"`   // Dot duration in seconds
+	Dash  float32 `json:"dash"`  // Dash duration in seconds, 0 until a dash is received
+}
+
+var morse = map[string]byte{
+	".-": 'A', "-...": 'B', "-.-.": 'C', "-..": 'D', ".": 'E', "..-.": 'F',
+	"--.": 'G', "....": 'H', "..": 'I', ".---": 'J', "-.-": 'K', ".-..": 'L',
+	"--": 'M', "-.": 'N', "---": 'O', ".--.": 'P', "--.-": 'Q', ".-.": 'R',
+	"...": 'S', "-": 'T', "..-": 'U', "...-": 'V', ".--": 'W', "-..-": 'X',
+	"-.--": 'Y', "--..": 'Z',
+	"-----": '0', ".----": '1', "..---": '2', "...--": '3', "....-": '4',
+	".....": '5', "-....": '6', "--...": '7', "---..": '8', "----.": '9',
+}
+
+// Code returns the dots and dashes of the letter or digit 'c', or "" if it has no Morse code
+func Code(c byte) string {
+	for code, letter := range morse {
+		if letter == c {
+			return code
+		}
+	}
+	return ""
+}
+
+// Decoder tracks the keying of the ident tone across successive blocks of
+// AM envelope samples and decodes the Morse code.
+type Decoder struct {
+	perTick  int        // envelope samples per keying decision
+	count    int        // samples accumulated in the current tick
+	settle   int        // samples left before the detector has settled
+	rot      complex128 // current phase of the tone reference
+	step     complex128 // phase increment per sample
+	alpha    float64    // smoothing coefficient of the tone detector
+	beta     float64    // smoothing coefficient of the envelope mean
+	s1, s2   complex128 // two pole lowpass of the mixed down tone
+	mean     float64    // envelope mean, i.e. the carrier level
+	hi, lo   float64    // keyed and unkeyed tone levels in percent
+	keyed    bool
+	run      int     // number of ticks in the current mark or space
+	dot      float64 // estimated dot duration in seconds
+	dash     float64 // estimated dash duration in seconds
+	letter   []byte  // dots and dashes of the current letter
+	text     []byte  // letters of the current identifier
+	last     Ident
+	haveDot  bool // true when the dot duration has been measured
+	haveDash bool // true when the dash duration has been measured
+}
+
+// NewDecoder creates a Decoder for an envelope sampled at 'fs' Hz
+func NewDecoder(fs float64) *Decoder {
+	return &Decoder{
+		perTick: int(math.Max(1, math.Round(fs*tick))),
+		settle:  int(fs * 5 * averaging),
+		rot:     1,
+		step:    cmplx.Exp(complex(0, -2*math.Pi*Tone/fs)),
+		alpha:   1 - math.Exp(-1/(fs*smoothing)),
+		beta:    1 - math.Exp(-1/(fs*averaging)),
+		dot:     0.12,
+		dash:    0.36,
+	}
+}
+
+// Ident returns the most recent decoding result
+func (d *Decoder) Ident() Ident {
+	r := d.last
+	r.Depth = float32(d.hi)
+	if d.haveDot {
+		r.Dot = float32(d.dot)
+		r.WPM = float32(1.2 / d.dot) // PARIS standard word
+	}
+	if d.haveDash {
+		r.Dash = float32(d.dash)
+	}
+	return r
+}
+
+// Process updates the decoder with the next block of AM envelope samples.
+// Only the real part of the envelope is used.
+func (d *Decoder) Process(envelope []complex128) {
+	for _, v := range envelope {
+		// Remove the carrier before mixing so it does not leak into the detector
+		x := real(v)
+		d.mean += d.beta * (x - d.mean)
+		d.s1 += complex(d.alpha, 0) * (complex(x-d.mean, 0)*d.rot - d.s1)
+		d.s2 += complex(d.alpha, 0) * (d.s1 - d.s2)
+		d.rot *= d.step
+		d.count++
+		if d.count == d.perTick {
+			if d.settle > 0 {
+				d.settle -= d.count
+			} else if d.mean > 0 {
+				d.update(2 * cmplx.Abs(d.s2) / d.mean * 100)
+			}
+			d.rot /= complex(cmplx.Abs(d.rot), 0) // avoid accumulating rounding errors
+			d.count = 0
+		}
+	}
+}
+
+// update tracks the keyed and unkeyed tone levels and makes a keying decision
+func (d *Decoder) update(level float64) {
+	if level > d.hi {
+		d.hi = level
+	} else {
+		d.hi -= (d.hi - level) * tick / peakDecay
+	}
+	if level < d.lo || d.lo == 0 {
+		d.lo = level
+	} else {
+		d.lo += (level - d.lo) * tick / floorRise
+	}
+
+	keyed := d.keyed
+	if d.hi-d.lo < minContrast {
+		keyed = false
+	} else if d.keyed {
+		keyed = level > d.lo+0.4*(d.hi-d.lo)
+	} else {
+		keyed = level > d.lo+0.6*(d.hi-d.lo)
+	}
+
+	if keyed != d.keyed {
+		if d.keyed {
+			d.mark(float64(d.run) * tick)
+		} else {
+			d.space(float64(d.run) * tick)
+		}
+		d.keyed = keyed
+		d.run = 0
+	}
+	d.run++
+	if !d.keyed && float64(d.run)*tick > 5*d.dot && len(d.letter)+len(d.text) > 0 {
+		// A long space ends the identifier
+		d.space(float64(d.run) * tick)
+	}
+}
+
+// mark classifies a completed key down period as a dot or a dash
+func (d *Decoder) mark(duration float64) {
+	if duration < d.dot/3 {
+		return // glitch
+	}
+	if duration < (d.dot+d.dash)/2 {
+		d.letter = append(d.letter, '.')
+		d.dot += 0.3 * (duration - d.dot)
+		d.haveDot = true
+	} else {
+		d.letter = append(d.letter, '-')
+		d.dash += 0.3 * (duration - d.dash)
+		d.haveDash = true
+	}
+	if d.dash < 2*d.dot {
+		d.dash = 2 * d.dot
+	}
+}
+
+// space handles a completed key up period, ending letters and identifiers
+func (d *Decoder) space(duration float64) {
+	if duration < 2*d.dot {
+		return // gap between elements of a letter
+	}
+	if len(d.letter) > 0 {
+		c, ok := morse[string(d.letter)]
+		if !ok {
+			c = '?'
+		}
+		d.text = append(d.text, c)
+		d.letter = d.letter[:0]
+	}
+	if duration > 5*d.dot && len(d.text) > 0 {
+		d.last.Text = string(d.text)
+		d.text = d.text[:0]
+	}
+}
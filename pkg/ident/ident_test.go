@@ -0,0 +1,67 @@
+package ident
+
+import (
+	"math"
+	"testing"
+)
+
+// keying returns the key down state for each 'dot' long time slot of 'text'
+func keying(text string) []bool {
+	var slots []bool
+	for i := range text {
+		for _, e := range Code(text[i]) {
+			n := 1
+			if e == '-' {
+				n = 3
+			}
+			for j := 0; j < n; j++ {
+				slots = append(slots, true)
+			}
+			slots = append(slots, false)
+		}
+		slots = append(slots, false, false)
+	}
+	return slots
+}
+
+func TestDecoder(t *testing.T) {
+	fs := 81920.0
+	dot := 0.1
+	// HIS has no dashes
+	for _, text := range []string{"IOSL", "HIS"} {
+		slots := keying(text)
+		// Key the identifier three times with 2 s silence in between
+		for i := 0; i < int(2/dot); i++ {
+			slots = append(slots, false)
+		}
+		slots = append(slots, slots...)
+		slots = append(slots, slots[:len(slots)/2]...)
+
+		decoder := NewDecoder(fs)
+		block := make([]complex128, int(fs/10))
+		var time float64
+		for time < float64(len(slots))*dot {
+			for i := range block {
+				v := 0.5 * (1 + 0.2*math.Sin(2*math.Pi*90*time) + 0.2*math.Sin(2*math.Pi*150*time))
+				if slot := int(time / dot); slot < len(slots) && slots[slot] {
+					v += 0.5 * 0.1 * math.Sin(2*math.Pi*Tone*time)
+				}
+				block[i] = complex(v, 0)
+				time += 1 / fs
+			}
+			decoder.Process(block)
+		}
+
+		r := decoder.Ident()
+		t.Logf("Ident:%q Depth:%.1f%% WPM:%.1f Dot:%.3fs Dash:%.3fs", r.Text, r.Depth, r.WPM, r.Dot, r.Dash)
+		if r.Text != text {
+			t.Errorf("decoded %q, want %q", r.Text, text)
+		}
+		if math.Abs(float64(r.Dot)-dot) > 0.02 || math.Abs(float64(r.WPM)-12) > 2.5 {
+			t.Errorf("%s: dot duration %.3f s at %.1f WPM, want %.3f s at 12 WPM", text, r.Dot, r.WPM, dot)
+		}
+		if math.Abs(float64(r.Depth)-10) > 1 {
+			t.Errorf("%s: ident depth %.1f%%, want 10%%", text, r.Depth)
+		}
+	}
+}
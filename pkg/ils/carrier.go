@@ -0,0 +1,11 @@
+package ils
+
+// Carrier holds the measurements of one carrier of a two-frequency (course/clearance) system
+type Carrier struct {
+	Offset float32 `json:"offset"` // Carrier frequency relative to the channel frequency in Hz
+	Mod150 float32 `json:"mod150"`
+	Mod90  float32 `json:"mod90"`
+	DDM    float32 `json:"ddm"`
+	SDM    float32 `json:"sdm"`
+	RF     float32 `json:"rf"`
+}
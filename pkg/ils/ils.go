@@ -0,0 +1,195 @@
+// Package ils defines the measurements and the interface shared by the
+// ILS demodulation algorithms.
+//
+// The algorithms register themselves when their package is imported,
+// similar to database/sql drivers:
+//
+//	import _ "github.com/asgaut/dumpils/pkg/demod2"
+//
+//	d, err := ils.New("demod2", ils.Config{SampleRate: 1310720, Offset: 200e3, Integration: 100 * time.Millisecond})
+package ils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ident"
+)
+
+// Meas holds the demodulated data
+type Meas struct {
+	Mod150  float32     `json:"mod150"`
+	Mod90   float32     `json:"mod90"`
+	DDM     float32     `json:"ddm"`
+	SDM     float32     `json:"sdm"`
+	RF      float32     `json:"rf"`
+	Offset  float32     `json:"offset"` // Frequency of the strongest carrier relative to the channel frequency in Hz
+	Phase   float32     `json:"phase"`  // Phase of the 150 Hz tone relative to the 90 Hz tone in degrees of 150 Hz, ±60°
+	Freq90  float32     `json:"freq90"` // Measured frequency of the 90 Hz tone in Hz, 0 until known
+	Freq150 float32     `json:"freq150"`
+	THD90   float32     `json:"thd90"` // Harmonic content of the 90 Hz tone in percent
+	THD150  float32     `json:"thd150"`
+	Ident   ident.Ident `json:"ident"`
+
+	// Carriers holds the course and clearance carriers in order of frequency if two
+	// carriers are detected in the channel. The measurements above are of the sum of both.
+	Carriers   []Carrier `json:"carriers,omitempty"`
+	Separation float32   `json:"separation,omitempty"` // Frequency separation of the carriers in Hz
+}
+
+// Frequencies of the navigation tones in Hz
+const (
+	Tone90  = 90.0
+	Tone150 = 150.0
+)
+
+// NoSignal is the RF level in dBFS reported without any input signal, as JSON has no -Inf
+const NoSignal = -200.0
+
+// DBFS returns the carrier amplitude 'level' relative to full scale in dBFS, at least NoSignal
+func DBFS(level float64) float32 {
+	if !(level > 0) {
+		return NoSignal
+	}
+	return float32(math.Max(20*math.Log10(level), NoSignal))
+}
+
+// Depth returns the modulation depth in percent of a tone with the DFT amplitude
+// 'tone' in one sideband on a carrier of DFT amplitude 'carrier', or 0 without a carrier
+func Depth(tone, carrier float64) float32 {
+	if !(carrier > 0) {
+		return 0
+	}
+	return float32(2 * tone / carrier * 100)
+}
+
+// DefaultIntegration is the integration period used when Config.Integration is zero
+const DefaultIntegration = 100 * time.Millisecond
+
+// MinIntegration is the shortest integration period which separates the 90 and 150 Hz tones
+const MinIntegration = time.Second / 30
+
+// ConfigError reports an invalid Config field
+type ConfigError struct {
+	Field  string  // Name of the Config field
+	Value  float64 // The invalid value
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s %g: %s", e.Field, e.Value, e.Reason)
+}
+
+// InputLengthError is returned by Process when it is called with the wrong number of samples
+type InputLengthError struct {
+	Got, Want int
+}
+
+func (e *InputLengthError) Error() string {
+	return fmt.Sprintf("got %d input samples, want %d", e.Got, e.Want)
+}
+
+// Config holds the parameters used to create a Demodulator.
+//
+// The measurements are calculated over a window of Integration length. With
+// Overlap > 0 successive windows share samples, so the measurements are
+// updated more often than once per Integration period at the same noise level.
+// Integration periods which are a multiple of 1/30 s (e.g. 100 ms, 200 ms or 1 s)
+// hold an integer number of periods of the 90, 150 and 1020 Hz tones.
+type Config struct {
+	SampleRate  float64       // Input sample rate in Hz
+	Offset      float64       // Channel frequency relative to the tuned center frequency in Hz
+	Integration time.Duration // Length of the analysis window
+	Overlap     float64       // Fraction of the window shared with the previous window, 0 <= Overlap < 1
+	AFC         bool          // Retune the channel filter to follow the received carrier frequency (demod2 only)
+}
+
+// Period returns the integration period, or DefaultIntegration if it is not set
+func (c Config) Period() time.Duration {
+	if c.Integration == 0 {
+		return DefaultIntegration
+	}
+	return c.Integration
+}
+
+// WindowSize returns the number of input samples in the analysis window
+func (c Config) WindowSize() int {
+	return int(math.Round(c.SampleRate * c.Period().Seconds()))
+}
+
+// BlockSize returns the number of new input samples to pass to each Process call
+func (c Config) BlockSize() int {
+	return int(math.Round(float64(c.WindowSize()) * (1 - c.Overlap)))
+}
+
+// Validate checks that the Config describes a usable demodulator.
+// The returned error is a *ConfigError.
+func (c Config) Validate() error {
+	switch {
+	case !(c.SampleRate > 0) || math.IsInf(c.SampleRate, 1):
+		return &ConfigError{"SampleRate", c.SampleRate, "must be a positive number"}
+	case math.IsNaN(c.Offset) || math.Abs(c.Offset) >= c.SampleRate/2:
+		return &ConfigError{"Offset", c.Offset, fmt.Sprintf("must be within ±%g Hz", c.SampleRate/2)}
+	case c.Period() < MinIntegration:
+		return &ConfigError{"Integration", c.Period().Seconds(), fmt.Sprintf("must be at least %v", MinIntegration)}
+	case !(c.Overlap >= 0 && c.Overlap < 1):
+		return &ConfigError{"Overlap", c.Overlap, "must be >= 0 and < 1"}
+	case c.BlockSize() < 1:
+		return &ConfigError{"Overlap", c.Overlap, "leaves no new samples per block"}
+	}
+	return nil
+}
+
+// Bin returns the (possibly fractional) DFT bin of frequency 'f' in the analysis window
+func (c Config) Bin(f float64) float64 {
+	return f * float64(c.WindowSize()) / c.SampleRate
+}
+
+// Demodulator is implemented by the ILS demodulation algorithms
+type Demodulator interface {
+	// Process demodulates a block of Config.BlockSize() IQ samples and
+	// returns the measurements over the latest analysis window
+	Process(iq []complex64) (Meas, error)
+	// Spectrum1 returns the amplitude spectrum of the input signal
+	Spectrum1() []float32
+	// Spectrum2 returns the amplitude spectrum of the demodulated AM signal
+	Spectrum2() []float32
+}
+
+// Factory creates a Demodulator from a Config
+type Factory func(cfg Config) (Demodulator, error)
+
+var algorithms = map[string]Factory{}
+
+// Register makes a demodulation algorithm available by name.
+// It panics if the name is registered twice.
+func Register(name string, f Factory) {
+	if _, dup := algorithms[name]; dup {
+		panic("ils: Register called twice for algorithm " + name)
+	}
+	algorithms[name] = f
+}
+
+// Algorithms returns the sorted names of the registered algorithms
+func Algorithms() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a Demodulator using the named algorithm
+func New(algorithm string, cfg Config) (Demodulator, error) {
+	f, ok := algorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown demodulation algorithm '%s' (registered: %v)", algorithm, Algorithms())
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return f(cfg)
+}
@@ -0,0 +1,102 @@
+package iq
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File is an IQ recording opened for reading. Reads start at the first sample
+// and end at the last sample.
+type File struct {
+	file     *os.File
+	Metadata Metadata // The sample rate and center frequency are 0 if unknown
+	Format   Format   // Sample format
+	Size     int64    // Bytes of samples
+	start    int64    // Offset of the first sample
+	read     int64    // Bytes of samples read
+}
+
+// Open opens the IQ recording 'name'. SigMF recordings and WAV files describe
+// their own sample format. Other files are raw IQ pairs in 'format', or in the
+// format named by the file extension if 'format' is empty, e.g. capture.cs16le,
+// or else in rtl_sdr format.
+func Open(name, format string) (*File, error) {
+	var meta Metadata
+	switch {
+	case IsSigMF(name):
+		s, err := ReadSigMF(name)
+		if err != nil {
+			return nil, err
+		}
+		if meta, err = s.Metadata(); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		name, _ = SigMFFiles(name)
+	case format != "":
+		meta.Format = format
+	default:
+		meta.Format = CU8.Name
+		if _, err := LookupFormat(strings.TrimPrefix(filepath.Ext(name), ".")); err == nil {
+			meta.Format = strings.TrimPrefix(filepath.Ext(name), ".")
+		}
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f := &File{file: file, Metadata: meta, Size: fi.Size()}
+	if strings.EqualFold(filepath.Ext(name), ".wav") {
+		f.Metadata, f.Size, err = ReadWAV(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if f.start, err = file.Seek(0, io.SeekCurrent); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if f.Size > fi.Size()-f.start || f.Size == 0 {
+			f.Size = fi.Size() - f.start // not updated by the writer
+		}
+	}
+	if f.Format, err = LookupFormat(f.Metadata.Format); err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.Size -= f.Size % int64(f.Format.Size)
+	return f, nil
+}
+
+// Read reads up to len(p) bytes of samples
+func (f *File) Read(p []byte) (int, error) {
+	if f.read >= f.Size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > f.Size-f.read {
+		p = p[:f.Size-f.read]
+	}
+	n, err := f.file.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+// Rewind moves to the first sample
+func (f *File) Rewind() error {
+	_, err := f.file.Seek(f.start, io.SeekStart)
+	f.read = 0
+	return err
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	return f.file.Close()
+}
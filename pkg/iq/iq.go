@@ -0,0 +1,124 @@
+// Package iq converts raw IQ sample data to complex samples
+package iq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// DecodeCU8 converts rtl_sdr style unsigned 8-bit IQ pairs in 'src' to
+// complex samples in 'dst', scaled to the range -1..1. It returns the
+// number of samples written, which is limited by the length of both slices.
+func DecodeCU8(dst []complex64, src []byte) int {
+	n := len(src) / 2
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = complex(float32(src[2*i])/127.5-1, float32(src[2*i+1])/127.5-1)
+	}
+	return n
+}
+
+// EncodeCU8 converts complex samples in 'src' to rtl_sdr style unsigned 8-bit
+// IQ pairs in 'dst', clipping at -1 and 1. It returns the number of samples written.
+func EncodeCU8(dst []byte, src []complex64) int {
+	n := len(dst) / 2
+	if len(src) < n {
+		n = len(src)
+	}
+	quantize := func(v float32) byte {
+		v = (v+1)*127.5 + 0.5
+		if v < 0 {
+			return 0
+		} else if v > 255 {
+			return 255
+		}
+		return byte(v)
+	}
+	for i := 0; i < n; i++ {
+		dst[2*i] = quantize(real(src[i]))
+		dst[2*i+1] = quantize(imag(src[i]))
+	}
+	return n
+}
+
+// DecodeCS8 converts signed 8-bit IQ pairs (HackRF) in 'src' to complex samples in 'dst'
+func DecodeCS8(dst []complex64, src []byte) int {
+	n := len(src) / 2
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = complex(float32(int8(src[2*i]))/128, float32(int8(src[2*i+1]))/128)
+	}
+	return n
+}
+
+// DecodeCS16LE converts signed 16-bit little-endian IQ pairs (Airspy, SDRplay)
+// in 'src' to complex samples in 'dst'
+func DecodeCS16LE(dst []complex64, src []byte) int {
+	n := len(src) / 4
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		re := int16(binary.LittleEndian.Uint16(src[4*i:]))
+		im := int16(binary.LittleEndian.Uint16(src[4*i+2:]))
+		dst[i] = complex(float32(re)/32768, float32(im)/32768)
+	}
+	return n
+}
+
+// DecodeCF32LE converts 32-bit little-endian floating point IQ pairs in 'src'
+// to complex samples in 'dst'
+func DecodeCF32LE(dst []complex64, src []byte) int {
+	n := len(src) / 8
+	if len(dst) < n {
+		n = len(dst)
+	}
+	for i := 0; i < n; i++ {
+		re := math.Float32frombits(binary.LittleEndian.Uint32(src[8*i:]))
+		im := math.Float32frombits(binary.LittleEndian.Uint32(src[8*i+4:]))
+		dst[i] = complex(re, im)
+	}
+	return n
+}
+
+// Format is an IQ sample format
+type Format struct {
+	Name     string                                // e.g. cu8, also the file extension of raw files
+	Datatype string                                // SigMF datatype
+	Size     int                                   // bytes per IQ pair
+	Decode   func(dst []complex64, src []byte) int // converts IQ pairs to complex samples
+}
+
+var formats = []Format{
+	{"cu8", "cu8", 2, DecodeCU8},
+	{"cs8", "ci8", 2, DecodeCS8},
+	{"cs16le", "ci16_le", 4, DecodeCS16LE},
+	{"cf32le", "cf32_le", 8, DecodeCF32LE},
+}
+
+// CU8 is the format of rtl_sdr and rtl_tcp
+var CU8 = formats[0]
+
+// Formats returns the names of the supported sample formats
+func Formats() []string {
+	var names []string
+	for _, f := range formats {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// LookupFormat returns the sample format with the name or SigMF datatype 'name'
+func LookupFormat(name string) (Format, error) {
+	for _, f := range formats {
+		if name == f.Name || name == f.Datatype {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unknown sample format '%s', must be one of %v", name, Formats())
+}
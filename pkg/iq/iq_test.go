@@ -0,0 +1,157 @@
+package iq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// samples are the expected values of the encoded samples below
+var samples = []complex64{complex(0.5, -0.25), complex(-1, 0)}
+
+var encoded = map[string][]byte{
+	"cu8":    {191, 95, 0, 127}, // 127.5 is zero
+	"cs8":    {64, 0xe0, 0x80, 0},
+	"cs16le": {0x00, 0x40, 0x00, 0xe0, 0x00, 0x80, 0x00, 0x00},
+	"cf32le": {0, 0, 0, 0x3f, 0, 0, 0x80, 0xbe, 0, 0, 0x80, 0xbf, 0, 0, 0, 0},
+}
+
+func TestFormats(t *testing.T) {
+	for _, name := range Formats() {
+		f, err := LookupFormat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, err := LookupFormat(f.Datatype); err != nil || g.Name != name {
+			t.Errorf("%s: SigMF datatype %s not found", name, f.Datatype)
+		}
+		src := encoded[name]
+		if len(src) != len(samples)*f.Size {
+			t.Fatalf("%s: %d bytes, want %d", name, len(src), len(samples)*f.Size)
+		}
+		dst := make([]complex64, len(samples)+1)
+		if n := f.Decode(dst, src); n != len(samples) {
+			t.Errorf("%s: decoded %d samples, want %d", name, n, len(samples))
+		}
+		for i, want := range samples {
+			if d := dst[i] - want; math.Abs(float64(real(d))) > 0.005 || math.Abs(float64(imag(d))) > 0.005 {
+				t.Errorf("%s: sample %d is %v, want %v", name, i, dst[i], want)
+			}
+		}
+	}
+	buf := make([]byte, 4)
+	if n := EncodeCU8(buf, []complex64{complex(0.5, -0.25), complex(-2, 2)}); n != 2 || !bytes.Equal(buf, []byte{191, 96, 0, 255}) {
+		t.Errorf("EncodeCU8 wrote %d samples %v, want [191 96 0 255]", n, buf)
+	}
+	if _, err := LookupFormat("cu16"); err == nil {
+		t.Error("unknown format cu16 accepted")
+	}
+}
+
+// wav returns a 16-bit WAV file with a padded JUNK chunk, an SDR# auxi chunk
+// and a trailing LIST chunk
+func wav(rate, center uint32, start time.Time, data []byte) []byte {
+	var b bytes.Buffer
+	le := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	chunk := func(id string, size int) {
+		b.WriteString(id)
+		le(uint32(size))
+	}
+	b.WriteString("RIFF")
+	le(uint32(0)) // not checked
+	b.WriteString("WAVE")
+	chunk("JUNK", 3)
+	b.Write([]byte{1, 2, 3, 0})
+	chunk("fmt ", 16)
+	le([]uint16{wavePCM, 2})
+	le([]uint32{rate, rate * 4})
+	le([]uint16{4, 16})
+	chunk("auxi", 164)
+	st := []uint16{uint16(start.Year()), uint16(start.Month()), uint16(start.Weekday()), uint16(start.Day()),
+		uint16(start.Hour()), uint16(start.Minute()), uint16(start.Second()), uint16(start.Nanosecond() / 1e6)}
+	le(st)
+	le(st)
+	le(center)
+	b.Write(make([]byte, 164-36))
+	chunk("data", len(data))
+	b.Write(data)
+	chunk("LIST", 4)
+	b.WriteString("INFO")
+	return b.Bytes()
+}
+
+func TestReadWAV(t *testing.T) {
+	// The sizes of the chunks are not trusted
+	for _, chunks := range []string{
+		"LIST\xf0\xff\xff\xffINFO",
+		"fmt \xf0\xff\xff\xff",
+		"fmt \x10\x00\x00\x00\x01\x00",
+	} {
+		if _, _, err := ReadWAV(strings.NewReader("RIFF\x00\x00\x00\x00WAVE" + chunks)); err == nil {
+			t.Errorf("no error for the chunks %q", chunks)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 5, 17, 10, 20, 30, 250e6, time.UTC)
+	files := map[string][]byte{
+		"sdrsharp.wav":      wav(2e6, 109900000, start, encoded["cs16le"]),
+		"hackrf.cs8":        encoded["cs8"],
+		"rtl.bin":           encoded["cu8"],
+		"airspy.sigmf-data": encoded["cf32le"],
+	}
+	for name, buf := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := Metadata{Format: "cf32le", SampleRate: 3e6, CenterFrequency: 110.1e6, Start: start}.sigmf()
+	if err := WriteSigMF(filepath.Join(dir, "airspy.sigmf-data"), s); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want Metadata
+	}{
+		{"sdrsharp.wav", Metadata{Format: "cs16le", SampleRate: 2e6, CenterFrequency: 109.9e6, Start: start}},
+		{"hackrf.cs8", Metadata{Format: "cs8"}},
+		{"rtl.bin", Metadata{Format: "cu8"}},
+		{"airspy.sigmf-meta", Metadata{Format: "cf32le", SampleRate: 3e6, CenterFrequency: 110.1e6, Start: start}},
+	}
+	for _, tc := range tests {
+		f, err := Open(filepath.Join(dir, tc.name), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Metadata != tc.want || f.Format.Name != tc.want.Format {
+			t.Errorf("%s: %+v, want %+v", tc.name, f.Metadata, tc.want)
+		}
+		for pass := 0; pass < 2; pass++ {
+			buf, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, encoded[f.Format.Name]) || f.Size != int64(len(buf)) {
+				t.Errorf("%s: read %v, size %d, want %v", tc.name, buf, f.Size, encoded[f.Format.Name])
+			}
+			if err := f.Rewind(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,164 @@
+package iq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata describes a recorded IQ file
+type Metadata struct {
+	Format          string    // Sample format, e.g. cu8
+	SampleRate      float64   // Hz
+	CenterFrequency float64   // Hz
+	Gain            float64   // Tuner gain in dB, unused with AGC
+	AGC             bool      // Automatic tuner gain
+	Start           time.Time // UTC time of the first sample
+}
+
+// Recorder writes raw rtl_sdr style IQ samples to files in a directory.
+// A new file is started when the current file reaches the size or duration
+// limit, or when the center frequency is changed. The files are SigMF
+// recordings, i.e. a .sigmf-data file with the samples and a .sigmf-meta file.
+type Recorder struct {
+	dir, prefix string
+	maxSize     int64
+	maxDuration time.Duration
+	meta        Metadata
+	sigmf       *SigMF // metadata of the current file
+	file        *os.File
+	name        string
+	written     int64     // bytes written to the current file
+	next        time.Time // start time of the next file if the samples are continuous
+}
+
+// NewRecorder creates a Recorder which writes files named after 'prefix' to 'dir'.
+// The files are limited to 'maxSize' bytes and 'maxDuration' of samples, unless
+// the limit is 0. No file is created until the first call to Write.
+func NewRecorder(dir, prefix string, maxSize int64, maxDuration time.Duration, meta Metadata) *Recorder {
+	if meta.Format == "" {
+		meta.Format = "cu8"
+	}
+	return &Recorder{dir: dir, prefix: prefix, maxSize: maxSize, maxDuration: maxDuration, meta: meta}
+}
+
+// limit returns the maximum number of bytes in a file, or 0 if unlimited
+func (r *Recorder) limit() int64 {
+	limit := r.maxSize
+	if r.maxDuration > 0 {
+		d := int64(r.maxDuration.Seconds()*r.meta.SampleRate) * 2
+		if limit == 0 || d < limit {
+			limit = d
+		}
+	}
+	return limit &^ 1 // whole IQ pairs
+}
+
+// open creates the next file and its metadata file
+func (r *Recorder) open() error {
+	r.meta.Start = r.next
+	if r.meta.Start.IsZero() {
+		r.meta.Start = time.Now().UTC()
+	}
+	base := fmt.Sprintf("%s_%s_%.0fHz", r.prefix, r.meta.Start.Format("20060102T150405.000Z"), r.meta.CenterFrequency)
+	name := filepath.Join(r.dir, base+SigMFDataExt)
+	r.sigmf = r.meta.sigmf()
+	if err := WriteSigMF(name, r.sigmf); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	r.file, r.name, r.written = f, name, 0
+	return nil
+}
+
+// Write records the samples in 'p', starting new files as needed
+func (r *Recorder) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if r.file == nil {
+			if err := r.open(); err != nil {
+				return total, err
+			}
+		}
+		n := len(p)
+		limit := r.limit()
+		if limit > 0 && int64(n) > limit-r.written {
+			n = int(limit - r.written)
+		}
+		n, err := r.file.Write(p[:n])
+		total += n
+		r.written += int64(n)
+		p = p[n:]
+		if err != nil {
+			return total, err
+		}
+		if limit > 0 && r.written >= limit {
+			if err := r.closeFile(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// SetCenterFrequency changes the center frequency in Hz of the recorded
+// samples. The following samples are written to a new file.
+func (r *Recorder) SetCenterFrequency(f float64) error {
+	if f == r.meta.CenterFrequency {
+		return nil
+	}
+	r.meta.CenterFrequency = f
+	return r.closeFile()
+}
+
+// Annotate marks the last 'samples' samples written with 'label' and 'comment',
+// e.g. "ident" and the decoded identifier. The annotations are written to the
+// metadata file when the file is closed.
+func (r *Recorder) Annotate(label, comment string, samples int64) {
+	if r.file == nil {
+		return
+	}
+	end := r.written / 2
+	if samples > end {
+		samples = end
+	}
+	r.sigmf.Annotations = append(r.sigmf.Annotations, SigMFAnnotation{
+		SampleStart: end - samples,
+		SampleCount: samples,
+		Label:       label,
+		Comment:     comment,
+	})
+}
+
+// File returns the name of the file being written, or the last file written
+func (r *Recorder) File() string {
+	return r.name
+}
+
+// closeFile closes the current file. The samples of the next file follow without a gap.
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	r.next = r.meta.Start.Add(time.Duration(float64(r.written/2) / r.meta.SampleRate * float64(time.Second)))
+	err := r.file.Close()
+	r.file = nil
+	if len(r.sigmf.Annotations) > 0 {
+		if err1 := WriteSigMF(r.name, r.sigmf); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// Close closes the current file. A following Write starts a new file
+// with the start time taken from the clock.
+func (r *Recorder) Close() error {
+	err := r.closeFile()
+	r.next = time.Time{}
+	return err
+}
@@ -0,0 +1,108 @@
+package iq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 1000 samples/s limited to 0.5 s or 1200 bytes per file
+	r := NewRecorder(dir, "loc", 1200, 500*time.Millisecond, Metadata{SampleRate: 1000, CenterFrequency: 109.9e6, Gain: 40})
+	block := make([]byte, 700)
+	for i := 0; i < 3; i++ {
+		if n, err := r.Write(block); err != nil || n != len(block) {
+			t.Fatalf("wrote %d bytes: %v", n, err)
+		}
+		if i == 0 {
+			r.Annotate("ident", "IFBS", 100)
+		}
+	}
+	if err := r.SetCenterFrequency(110.1e6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "loc_*"+SigMFDataExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{1000, 1000, 100, 700}
+	if len(files) != len(want) {
+		t.Fatalf("got files %v, want %d files", files, len(want))
+	}
+	var start time.Time
+	for i, name := range files {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := ReadSigMF(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta, err := s.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %d bytes, %+v", filepath.Base(name), fi.Size(), meta)
+		if fi.Size() != want[i] {
+			t.Errorf("%s: %d bytes, want %d", name, fi.Size(), want[i])
+		}
+		if meta.Format != "cu8" || meta.SampleRate != 1000 || s.Global.Gain == nil || *s.Global.Gain != 40 || meta.Gain != 40 || meta.AGC {
+			t.Errorf("%s: metadata %+v", name, s.Global)
+		}
+		wantAnnotations := map[bool]int{true: 1, false: 0}[i == 0]
+		if len(s.Annotations) != wantAnnotations {
+			t.Errorf("%s: %d annotations, want %d", name, len(s.Annotations), wantAnnotations)
+		} else if i == 0 && s.Annotations[0] != (SigMFAnnotation{SampleStart: 250, SampleCount: 100, Label: "ident", Comment: "IFBS"}) {
+			t.Errorf("%s: annotation %+v", name, s.Annotations[0])
+		}
+		if d := []time.Duration{0, 500, 500, 50}[i] * time.Millisecond; i > 0 && meta.Start.Sub(start) != d {
+			t.Errorf("%s: starts %v after the previous file, want %v", name, meta.Start.Sub(start), d)
+		}
+		if f := map[bool]float64{true: 110.1e6, false: 109.9e6}[i == 3]; meta.CenterFrequency != f {
+			t.Errorf("%s: center frequency %.0f Hz, want %.0f Hz", name, meta.CenterFrequency, f)
+		}
+		start = meta.Start
+	}
+}
+
+func TestSigMFGain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigmf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "loc"+SigMFDataExt)
+	for _, m := range []Metadata{{Gain: 0}, {Gain: 49.6}, {Gain: 40, AGC: true}} {
+		m.Format, m.SampleRate = "cu8", 1000
+		if err := WriteSigMF(name, m.sigmf()); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ReadSigMF(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]float64{true: 0, false: m.Gain}[m.AGC]; got.Gain != want || got.AGC != m.AGC {
+			t.Errorf("gain %g dB, AGC %v, want %g dB, AGC %v", got.Gain, got.AGC, want, m.AGC)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package iq
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// SigMF file extensions and version (https://sigmf.org)
+const (
+	SigMFDataExt = ".sigmf-data"
+	SigMFMetaExt = ".sigmf-meta"
+	SigMFVersion = "1.0.0"
+)
+
+// sigmfTime is the format of core:datetime
+const sigmfTime = "2006-01-02T15:04:05.000Z"
+
+// SigMF holds the metadata file of a SigMF recording
+type SigMF struct {
+	Global      SigMFGlobal       `json:"global"`
+	Captures    []SigMFCapture    `json:"captures"`
+	Annotations []SigMFAnnotation `json:"annotations"`
+}
+
+// SigMFGlobal holds the global object of the metadata. The tuner gain is
+// in the fields of the dumpils extension.
+type SigMFGlobal struct {
+	Datatype    string           `json:"core:datatype"` // e.g. cu8 or ci16_le
+	SampleRate  float64          `json:"core:sample_rate,omitempty"`
+	Version     string           `json:"core:version"`
+	Description string           `json:"core:description,omitempty"`
+	Recorder    string           `json:"core:recorder,omitempty"`
+	HW          string           `json:"core:hw,omitempty"`
+	Extensions  []SigMFExtension `json:"core:extensions,omitempty"`
+	Gain        *float64         `json:"dumpils:gain,omitempty"` // Tuner gain in dB, nil if unknown or automatic
+	AGC         bool             `json:"dumpils:agc,omitempty"`  // Automatic tuner gain
+}
+
+// SigMFExtension declares a namespace of the fields of the metadata
+type SigMFExtension struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Optional bool   `json:"optional"`
+}
+
+// SigMFCapture holds a capture segment of the metadata
+type SigMFCapture struct {
+	SampleStart int64   `json:"core:sample_start"`
+	Frequency   float64 `json:"core:frequency,omitempty"` // center frequency in Hz
+	Datetime    string  `json:"core:datetime,omitempty"`  // UTC time of the first sample
+}
+
+// SigMFAnnotation marks an event in the samples
+type SigMFAnnotation struct {
+	SampleStart int64  `json:"core:sample_start"`
+	SampleCount int64  `json:"core:sample_count,omitempty"`
+	Label       string `json:"core:label,omitempty"`
+	Comment     string `json:"core:comment,omitempty"`
+}
+
+// IsSigMF reports whether 'name' is a SigMF data or metadata file
+func IsSigMF(name string) bool {
+	return strings.HasSuffix(name, SigMFDataExt) || strings.HasSuffix(name, SigMFMetaExt)
+}
+
+// SigMFFiles returns the data and metadata file names of the SigMF recording
+// of which 'name' is the data file, the metadata file or the base name
+func SigMFFiles(name string) (data, meta string) {
+	base := strings.TrimSuffix(strings.TrimSuffix(name, SigMFDataExt), SigMFMetaExt)
+	return base + SigMFDataExt, base + SigMFMetaExt
+}
+
+// ReadSigMF reads the metadata file of the SigMF recording 'name'
+func ReadSigMF(name string) (*SigMF, error) {
+	_, meta := SigMFFiles(name)
+	buf, err := ioutil.ReadFile(meta)
+	if err != nil {
+		return nil, err
+	}
+	var s SigMF
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", meta, err)
+	}
+	return &s, nil
+}
+
+// WriteSigMF writes the metadata file of the SigMF recording 'name'
+func WriteSigMF(name string, s *SigMF) error {
+	_, meta := SigMFFiles(name)
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(meta, buf, 0644)
+}
+
+// Metadata returns the sample format, sample rate, center frequency and start
+// time of the first capture of the recording, and the gain of a recording
+// made by dumpils
+func (s *SigMF) Metadata() (Metadata, error) {
+	m := Metadata{SampleRate: s.Global.SampleRate, AGC: s.Global.AGC}
+	if s.Global.Gain != nil {
+		m.Gain = *s.Global.Gain
+	}
+	f, err := LookupFormat(s.Global.Datatype)
+	if err != nil {
+		return m, fmt.Errorf("unsupported SigMF datatype '%s'", s.Global.Datatype)
+	}
+	m.Format = f.Name
+	if m.SampleRate <= 0 {
+		return m, fmt.Errorf("SigMF sample rate missing")
+	}
+	if len(s.Captures) > 0 {
+		m.CenterFrequency = s.Captures[0].Frequency
+		if s.Captures[0].Datetime != "" {
+			t, err := time.Parse(time.RFC3339Nano, s.Captures[0].Datetime)
+			if err != nil {
+				return m, fmt.Errorf("SigMF datetime: %v", err)
+			}
+			m.Start = t
+		}
+	}
+	return m, nil
+}
+
+// sigmf returns the SigMF metadata of a recording described by 'm'
+func (m Metadata) sigmf() *SigMF {
+	datatype := m.Format
+	if f, err := LookupFormat(m.Format); err == nil {
+		datatype = f.Datatype
+	}
+	var gain *float64
+	if !m.AGC {
+		gain = &m.Gain
+	}
+	return &SigMF{
+		Global: SigMFGlobal{
+			Datatype:   datatype,
+			SampleRate: m.SampleRate,
+			Version:    SigMFVersion,
+			Recorder:   "dumpils",
+			HW:         "RTL-SDR dongle served by rtl_tcp",
+			Extensions: []SigMFExtension{{Name: "dumpils", Version: "1.0.0", Optional: true}},
+			Gain:       gain,
+			AGC:        m.AGC,
+		},
+		Captures: []SigMFCapture{{
+			Frequency: m.CenterFrequency,
+			Datetime:  m.Start.UTC().Format(sigmfTime),
+		}},
+		Annotations: []SigMFAnnotation{},
+	}
+}
@@ -0,0 +1,117 @@
+package iq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// WAV format tags
+const (
+	wavePCM        = 1
+	waveFloat      = 3
+	waveExtensible = 0xfffe
+)
+
+// maxChunk is the largest fmt or auxi chunk read, the other chunks are skipped
+const maxChunk = 4096
+
+// ReadWAV reads the header of a 2-channel WAV file with I in the left and Q in
+// the right channel, up to the start of the samples in the data chunk. It
+// returns the sample format, the sample rate and, if the file has an SDR# or
+// SDRuno auxi chunk, the center frequency and start time, together with the
+// size of the data chunk in bytes.
+func ReadWAV(r io.Reader) (Metadata, int64, error) {
+	var m Metadata
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return m, 0, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return m, 0, fmt.Errorf("not a WAV file")
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return m, 0, fmt.Errorf("WAV data chunk missing: %v", err)
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		if id == "data" {
+			if m.Format == "" {
+				return m, 0, fmt.Errorf("WAV fmt chunk missing")
+			}
+			return m, size, nil
+		}
+		padded := size + size&1 // chunks are padded to an even size
+		if id == "fmt " && size > maxChunk {
+			return m, 0, fmt.Errorf("WAV fmt chunk of %d bytes too long", size)
+		}
+		if (id != "fmt " && id != "auxi") || size > maxChunk {
+			if _, err := io.CopyN(ioutil.Discard, r, padded); err != nil {
+				return m, 0, fmt.Errorf("WAV data chunk missing: %v", err)
+			}
+			continue
+		}
+		chunk := make([]byte, padded)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return m, 0, err
+		}
+		if id == "fmt " {
+			if err := m.wavFormat(chunk); err != nil {
+				return m, 0, err
+			}
+		} else {
+			m.wavAuxi(chunk)
+		}
+	}
+}
+
+// wavFormat reads the fmt chunk
+func (m *Metadata) wavFormat(chunk []byte) error {
+	if len(chunk) < 16 {
+		return fmt.Errorf("WAV fmt chunk too short")
+	}
+	tag := binary.LittleEndian.Uint16(chunk[0:])
+	channels := binary.LittleEndian.Uint16(chunk[2:])
+	rate := binary.LittleEndian.Uint32(chunk[4:])
+	bits := binary.LittleEndian.Uint16(chunk[14:])
+	if tag == waveExtensible && len(chunk) >= 26 {
+		tag = binary.LittleEndian.Uint16(chunk[24:]) // first two bytes of the subformat GUID
+	}
+	if channels != 2 {
+		return fmt.Errorf("WAV file has %d channels, want 2 (I and Q)", channels)
+	}
+	switch {
+	case tag == wavePCM && bits == 8:
+		m.Format = "cu8" // 8-bit WAV samples are unsigned
+	case tag == wavePCM && bits == 16:
+		m.Format = "cs16le"
+	case tag == waveFloat && bits == 32:
+		m.Format = "cf32le"
+	default:
+		return fmt.Errorf("unsupported WAV format %d with %d bits", tag, bits)
+	}
+	m.SampleRate = float64(rate)
+	return nil
+}
+
+// wavAuxi reads the auxi chunk written by SDR# and SDRuno. It starts with the
+// start and stop time as Windows SYSTEMTIME structures followed by the center
+// frequency in Hz.
+func (m *Metadata) wavAuxi(chunk []byte) {
+	if len(chunk) < 36 {
+		return
+	}
+	var st [8]int
+	for i := range st {
+		st[i] = int(binary.LittleEndian.Uint16(chunk[2*i:]))
+	}
+	// year, month, day of week, day, hour, minute, second, milliseconds, taken as UTC
+	if st[0] != 0 {
+		m.Start = time.Date(st[0], time.Month(st[1]), st[3], st[4], st[5], st[6], st[7]*1e6, time.UTC)
+	}
+	m.CenterFrequency = float64(binary.LittleEndian.Uint32(chunk[32:]))
+}
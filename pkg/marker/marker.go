@@ -0,0 +1,302 @@
+// Package marker implements a receiver for the 75 MHz ILS marker beacons.
+//
+// The outer (OM), middle (MM) and inner (IM) markers are identified by their
+// keyed modulation tone and keying pattern:
+//
+//	OM: 400 Hz, continuous dashes, 2 per second
+//	MM: 1300 Hz, alternating dots and dashes
+//	IM: 3000 Hz, continuous dots, 6 per second
+package marker
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/dsp"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/ktye/fft"
+)
+
+// Frequency is the carrier frequency of all marker beacons in Hz
+const Frequency = 75e6
+
+const (
+	tick       = 0.005 // seconds between keying decisions
+	smoothing  = 0.003 // time constant of the tone detectors in seconds
+	averaging  = 0.02  // time constant of the carrier level in seconds
+	onLevel    = 30.0  // tone modulation depth in percent to detect key down
+	offLevel   = 15.0  // tone modulation depth in percent to detect key up
+	maxDot     = 0.2   // longest mark in seconds classified as a dot
+	hold       = 1.0   // seconds without keying before a marker is lost
+	maxPattern = 8     // keying elements kept in Meas.Pattern
+	maxEvents  = 20    // marker events kept in Meas.Events
+)
+
+// beacons lists the marker tones and keying. The element is the only keying
+// element of the marker, or 0 if dots and dashes alternate.
+var beacons = [...]struct {
+	name    string
+	tone    float64
+	element byte
+}{
+	{"OM", 400, '-'},
+	{"MM", 1300, 0},
+	{"IM", 3000, '.'},
+}
+
+// Meas holds the marker beacon measurements
+type Meas struct {
+	RF      float32 `json:"rf"`      // Carrier level in dBFS
+	Active  string  `json:"active"`  // OM, MM or IM while a marker is received, otherwise empty
+	Pattern string  `json:"pattern"` // Latest keying elements, e.g. ".-.-"
+	Mod400  float32 `json:"mod400"`  // Outer marker tone modulation depth in percent
+	Mod1300 float32 `json:"mod1300"` // Middle marker tone modulation depth in percent
+	Mod3000 float32 `json:"mod3000"` // Inner marker tone modulation depth in percent
+	Events  []Event `json:"events"`  // Most recent marker passages, oldest first
+}
+
+// Event describes the reception of a marker beacon
+type Event struct {
+	Marker   string  `json:"marker"`   // OM, MM or IM
+	Start    float64 `json:"start"`    // Seconds since the start of the input
+	Duration float64 `json:"duration"` // Seconds, zero while the marker is received
+	RF       float32 `json:"rf"`       // Peak carrier level in dBFS
+}
+
+// toneDetector measures the modulation depth of one tone in the AM envelope
+type toneDetector struct {
+	rot, step complex128
+	s1, s2    complex128 // two pole lowpass of the mixed down tone
+}
+
+// Demodulator contains preallocated buffers and state for the marker beacon receiver
+type Demodulator struct {
+	n           int // input samples per Process call
+	fs          float64
+	dec         *demod2.Decimator
+	fft1, fft2  fft.FFT
+	IQ          []complex128 // input samples of the latest Process call
+	FFT1        []complex128
+	LF          []complex128 // decimated channel samples of the latest Process call
+	Envelope    []complex128 // analysis window of the demodulated AM signal
+	FFT2        []complex128
+	alpha       float64 // smoothing coefficient of the tone detectors
+	beta        float64 // smoothing coefficient of the carrier level
+	perTick     int
+	count       int
+	samples     int64 // decimated samples processed since the start
+	mean        float64
+	detectors   [len(beacons)]toneDetector
+	levels      [len(beacons)]float64 // highest tone level in the latest block
+	keyed       bool
+	tone        int // index into beacons of the keyed tone
+	run         int // number of ticks in the current mark or space
+	pattern     []byte
+	starts      []float64 // start of each element of the pattern in seconds
+	patternTone int       // index into beacons of the tone of the pattern
+	active      int       // index into beacons of the received marker, or -1
+	lastMark    float64   // end of the latest key down period in seconds
+	meas        Meas
+}
+
+// NewDemodulator creates a marker beacon Demodulator.
+// The returned error is a *ils.ConfigError if the Config is invalid.
+func NewDemodulator(cfg ils.Config) (*Demodulator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	dec, err := demod2.NewDecimator(cfg.SampleRate, cfg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	numSamples := cfg.BlockSize()
+	windowSize := int(math.Round(dec.OutputRate() * cfg.Period().Seconds()))
+	f1, err := fft.New(dsp.NextPow2(numSamples))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT1: %v", err)
+	}
+	f2, err := fft.New(dsp.NextPow2(windowSize))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT2: %v", err)
+	}
+	fs := dec.OutputRate()
+	d := &Demodulator{
+		n:        numSamples,
+		fs:       fs,
+		dec:      dec,
+		fft1:     f1,
+		fft2:     f2,
+		IQ:       make([]complex128, numSamples),
+		FFT1:     make([]complex128, f1.N),
+		LF:       make([]complex128, numSamples/dec.Factor()+1),
+		Envelope: make([]complex128, windowSize),
+		FFT2:     make([]complex128, f2.N),
+		alpha:    1 - math.Exp(-1/(fs*smoothing)),
+		beta:     1 - math.Exp(-1/(fs*averaging)),
+		perTick:  int(math.Max(1, math.Round(fs*tick))),
+		active:   -1,
+	}
+	for i, b := range beacons {
+		d.detectors[i] = toneDetector{rot: 1, step: cmplx.Exp(complex(0, -2*math.Pi*b.tone/fs))}
+	}
+	return d, nil
+}
+
+// Spectrum1 returns the amplitude spectrum of the input samples
+func (d *Demodulator) Spectrum1() []float32 {
+	return dsp.Spectrum(d.fft1, d.IQ, d.FFT1)
+}
+
+// Spectrum2 returns the amplitude spectrum of the demodulated AM signal
+func (d *Demodulator) Spectrum2() []float32 {
+	return dsp.Spectrum(d.fft2, d.Envelope, d.FFT2)
+}
+
+// Process input samples and update the marker beacon measurements.
+// The 'iq' slice holds the samples following the previous call to Process.
+func (d *Demodulator) Process(iq []complex64) (Meas, error) {
+	if len(iq) != d.n {
+		return d.copyMeas(), &ils.InputLengthError{Got: len(iq), Want: d.n}
+	}
+	dsp.ToComplex128(iq, d.IQ)
+	n := d.dec.Process(d.IQ, d.LF)
+	lf := d.LF[:n]
+	if n > len(d.Envelope) {
+		lf = lf[n-len(d.Envelope):]
+	}
+	copy(d.Envelope, d.Envelope[len(lf):])
+	envelope := d.Envelope[len(d.Envelope)-len(lf):]
+
+	d.levels = [len(beacons)]float64{}
+	for i, v := range lf {
+		x := cmplx.Abs(v)
+		envelope[i] = complex(x, 0)
+		d.mean += d.beta * (x - d.mean)
+		for j := range d.detectors {
+			t := &d.detectors[j]
+			t.s1 += complex(d.alpha, 0) * (complex(x-d.mean, 0)*t.rot - t.s1)
+			t.s2 += complex(d.alpha, 0) * (t.s1 - t.s2)
+			t.rot *= t.step
+		}
+		d.samples++
+		d.count++
+		if d.count == d.perTick {
+			d.count = 0
+			d.update()
+		}
+	}
+	for j := range d.detectors {
+		t := &d.detectors[j]
+		t.rot /= complex(cmplx.Abs(t.rot), 0) // avoid accumulating rounding errors
+	}
+
+	d.meas.Mod400 = float32(d.levels[0])
+	d.meas.Mod1300 = float32(d.levels[1])
+	d.meas.Mod3000 = float32(d.levels[2])
+	d.meas.Pattern = string(d.pattern)
+	d.meas.Active = ""
+	if d.active >= 0 {
+		d.meas.Active = beacons[d.active].name
+	}
+	d.meas.RF = ils.DBFS(d.mean) // Carrier power in dBFS
+	if d.active >= 0 && d.meas.RF > d.meas.Events[len(d.meas.Events)-1].RF {
+		d.meas.Events[len(d.meas.Events)-1].RF = d.meas.RF
+	}
+	return d.copyMeas(), nil
+}
+
+// copyMeas returns the measurements without sharing the event history
+func (d *Demodulator) copyMeas() Meas {
+	m := d.meas
+	m.Events = append([]Event(nil), d.meas.Events...)
+	return m
+}
+
+// update measures the tone levels and decodes the keying
+func (d *Demodulator) update() {
+	best, level := 0, 0.0
+	for j := range d.detectors {
+		l := 0.0
+		if d.mean > 0 {
+			l = 2 * cmplx.Abs(d.detectors[j].s2) / d.mean * 100
+		}
+		if l > d.levels[j] {
+			d.levels[j] = l
+		}
+		if l > level {
+			best, level = j, l
+		}
+	}
+
+	keyed := level > onLevel || (d.keyed && best == d.tone && level > offLevel)
+	if keyed != d.keyed || (keyed && best != d.tone) {
+		if d.keyed {
+			d.mark(float64(d.run) * tick)
+		}
+		d.keyed = keyed
+		d.tone = best
+		d.run = 0
+	}
+	d.run++
+	if !d.keyed && float64(d.run)*tick > hold && d.active >= 0 {
+		d.lost()
+	}
+}
+
+// mark adds a completed key down period to the pattern and checks if it
+// identifies a marker
+func (d *Demodulator) mark(duration float64) {
+	d.lastMark = float64(d.samples) / d.fs
+	start := d.lastMark - duration
+	e := byte('-')
+	if duration < maxDot {
+		e = '.'
+	}
+	if d.active >= 0 && d.active != d.tone {
+		d.lost()
+	}
+	if len(d.pattern) > 0 && d.patternTone != d.tone {
+		d.pattern = d.pattern[:0]
+		d.starts = d.starts[:0]
+	}
+	d.patternTone = d.tone
+	d.pattern = append(d.pattern, e)
+	d.starts = append(d.starts, start)
+	if len(d.pattern) > maxPattern {
+		d.pattern = d.pattern[1:]
+		d.starts = d.starts[1:]
+	}
+	if d.active < 0 && valid(d.pattern, beacons[d.tone].element) {
+		d.active = d.tone
+		d.meas.Events = append(d.meas.Events, Event{
+			Marker: beacons[d.tone].name,
+			Start:  d.starts[len(d.starts)-2], // first element of the matched keying
+			RF:     ils.DBFS(d.mean),
+		})
+		if len(d.meas.Events) > maxEvents {
+			d.meas.Events = d.meas.Events[1:]
+		}
+	}
+}
+
+// lost ends the current marker event
+func (d *Demodulator) lost() {
+	e := &d.meas.Events[len(d.meas.Events)-1]
+	e.Duration = d.lastMark - e.Start
+	d.active = -1
+}
+
+// valid returns true if the last keying elements of 'pattern' match 'element',
+// or alternate if 'element' is 0
+func valid(pattern []byte, element byte) bool {
+	if len(pattern) < 2 {
+		return false
+	}
+	a, b := pattern[len(pattern)-2], pattern[len(pattern)-1]
+	if element == 0 {
+		return a != b
+	}
+	return a == element && b == element
+}
@@ -0,0 +1,103 @@
+package marker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// keyer returns the key state at time 't' for a repeated pattern of
+// dots and dashes with 'dot' and 'dash' durations and 'gap' between elements
+func keyer(pattern string, dot, dash, gap float64) func(t float64) bool {
+	var period float64
+	for _, e := range pattern {
+		if e == '.' {
+			period += dot + gap
+		} else {
+			period += dash + gap
+		}
+	}
+	return func(t float64) bool {
+		t = math.Mod(t, period)
+		for _, e := range pattern {
+			l := dash
+			if e == '.' {
+				l = dot
+			}
+			if t < l {
+				return true
+			}
+			t -= l + gap
+			if t < 0 {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		tone    float64
+		keyed   func(t float64) bool
+		element byte
+	}{
+		{"OM", 400, keyer("-", 0, 0.375, 0.125), '-'},
+		{"MM", 1300, keyer(".-", 0.125, 0.375, 0.125), 0},
+		{"IM", 3000, keyer(".", 0.083, 0, 0.083), '.'},
+	}
+	fs := 1.024e6
+	offset := 250e3
+	for _, tc := range tests {
+		cfg := ils.Config{SampleRate: fs, Offset: offset}
+		d, err := NewDemodulator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := cfg.BlockSize()
+		iq := make([]complex64, n)
+		var m Meas
+		var tm float64
+		// Fly over the marker for 4 seconds followed by 2 seconds of no signal
+		for block := 0; block < 60; block++ {
+			for i := range iq {
+				a := 0.0
+				if tm < 4 {
+					a = 0.3
+					if tc.keyed(tm) {
+						a *= 1 + 0.95*math.Sin(2*math.Pi*tc.tone*tm)
+					}
+				}
+				ph := 2 * math.Pi * offset * tm
+				iq[i] = complex64(complex(a*math.Cos(ph)+1e-4, a*math.Sin(ph)))
+				tm += 1 / fs
+			}
+			m, err = d.Process(iq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block == 30 {
+				if m.Active != tc.name {
+					t.Errorf("%s: active marker is %q", tc.name, m.Active)
+				}
+				if len(m.Pattern) < 4 || !valid([]byte(m.Pattern), tc.element) {
+					t.Errorf("%s: unexpected pattern %q", tc.name, m.Pattern)
+				}
+			}
+		}
+		t.Logf("%s: %+v", tc.name, m)
+		if len(m.Events) != 1 {
+			t.Fatalf("%s: got %d events, want 1", tc.name, len(m.Events))
+		}
+		// The event lasts from the first to the last keying element
+		e := m.Events[0]
+		if e.Marker != tc.name || e.Start > 0.1 || e.Duration < 3.6 || e.Duration > 4.2 || math.Abs(float64(e.RF)+10.5) > 1 {
+			t.Errorf("%s: event %+v", tc.name, e)
+		}
+		if m.Active != "" {
+			t.Errorf("%s: marker still active", tc.name)
+		}
+	}
+}
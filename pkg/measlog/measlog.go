@@ -0,0 +1,223 @@
+// Package measlog writes the measurements of a source to CSV or JSON Lines
+// files, one line per block, as an audit trail of the monitored signal.
+//
+// A new file is started every day (UTC) and/or when the file reaches a size
+// limit. The files which are complete are compressed with gzip.
+package measlog
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/marker"
+	"github.com/asgaut/dumpils/pkg/vor"
+)
+
+// File formats
+const (
+	CSV   = "csv"   // The ILS measurements in the columns of Columns
+	JSONL = "jsonl" // All measurements as one JSON object per line
+)
+
+// Columns are the header of the CSV files
+var Columns = []string{"time", "status", "rf", "ddm", "sdm", "mod90", "mod150", "offset",
+	"phase", "freq90", "freq150", "thd90", "thd150", "ident", "identDepth"}
+
+// Record is the measurements of a block. The marker beacon and VOR
+// measurements are only written to the JSON Lines files.
+type Record struct {
+	ils.Meas
+	Marker *marker.Meas `json:"marker,omitempty"`
+	VOR    *vor.Meas    `json:"vor,omitempty"`
+}
+
+// Options controls the files written by a Logger
+type Options struct {
+	Format   string // CSV or JSONL
+	Daily    bool   // Start a new file at midnight UTC
+	MaxSize  int64  // Start a new file when the file reaches MaxSize bytes, unless 0
+	Compress bool   // Compress the complete files with gzip
+}
+
+// Logger writes measurements to files in a directory
+type Logger struct {
+	dir, prefix string
+	opts        Options
+	file        *os.File
+	csv         *csv.Writer
+	name        string
+	day         string // UTC date of the current file
+	written     int64  // bytes written to the current file
+	compressing sync.WaitGroup
+	mu          sync.Mutex
+	err         error // first compression error
+}
+
+// New creates a Logger which writes files named after 'prefix' to 'dir'.
+// No file is created until the first call to Log.
+func New(dir, prefix string, opts Options) (*Logger, error) {
+	if opts.Format != CSV && opts.Format != JSONL {
+		return nil, fmt.Errorf("unknown measurement log format '%s', must be %s or %s", opts.Format, CSV, JSONL)
+	}
+	return &Logger{dir: dir, prefix: prefix, opts: opts}, nil
+}
+
+// File returns the name of the file being written, or of the last file written
+func (l *Logger) File() string {
+	return l.name
+}
+
+// open creates the file of the measurements at time 't'. A file started in
+// the same millisecond as an existing file, e.g. after a rotation, gets a
+// sequence number.
+func (l *Logger) open(t time.Time) error {
+	var f *os.File
+	var name string
+	var err error
+	for seq := 0; ; seq++ {
+		name = fmt.Sprintf("%s_%s", l.prefix, t.Format("20060102T150405.000Z"))
+		if seq > 0 {
+			name += fmt.Sprintf("_%d", seq)
+		}
+		name = filepath.Join(l.dir, name+"."+l.opts.Format)
+		if _, err := os.Stat(name + ".gz"); err == nil {
+			continue
+		}
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	l.file, l.name, l.day, l.written = f, name, t.Format("2006-01-02"), 0
+	if l.opts.Format == CSV {
+		l.csv = csv.NewWriter(countingWriter{l})
+		return l.writeCSV(Columns)
+	}
+	return nil
+}
+
+// countingWriter writes to the file of the Logger and counts the bytes written
+type countingWriter struct {
+	l *Logger
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.l.file.Write(p)
+	w.l.written += int64(n)
+	return n, err
+}
+
+// writeCSV writes a CSV record to the file
+func (l *Logger) writeCSV(record []string) error {
+	l.csv.Write(record)
+	l.csv.Flush()
+	return l.csv.Error()
+}
+
+// Log writes the measurements 'm' made at time 't' and the 'status' of the
+// source, starting a new file as needed
+func (l *Logger) Log(t time.Time, status string, m Record) error {
+	t = t.UTC()
+	if l.file != nil && ((l.opts.Daily && t.Format("2006-01-02") != l.day) ||
+		(l.opts.MaxSize > 0 && l.written >= l.opts.MaxSize)) {
+		if err := l.closeFile(); err != nil {
+			return err
+		}
+	}
+	if l.file == nil {
+		if err := l.open(t); err != nil {
+			return err
+		}
+	}
+	if l.opts.Format == CSV {
+		f := func(v float32) string { return strconv.FormatFloat(float64(v), 'f', -1, 32) }
+		return l.writeCSV([]string{t.Format(time.RFC3339Nano), status, f(m.RF), f(m.DDM), f(m.SDM), f(m.Mod90), f(m.Mod150), f(m.Offset),
+			f(m.Phase), f(m.Freq90), f(m.Freq150), f(m.THD90), f(m.THD150), m.Ident.Text, f(m.Ident.Depth)})
+	}
+	line := struct {
+		Time   time.Time `json:"time"`
+		Status string    `json:"status"`
+		Record
+	}{t, status, m}
+	buf, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = countingWriter{l}.Write(append(buf, '\n'))
+	return err
+}
+
+// closeFile closes the current file and compresses it in the background
+func (l *Logger) closeFile() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file, l.csv = nil, nil
+	if err == nil && l.opts.Compress {
+		l.compressing.Add(1)
+		go func(name string) {
+			defer l.compressing.Done()
+			if err := compress(name); err != nil {
+				l.mu.Lock()
+				if l.err == nil {
+					l.err = err
+				}
+				l.mu.Unlock()
+			}
+		}(l.name)
+	}
+	return err
+}
+
+// Close closes the current file and waits until the files are compressed
+func (l *Logger) Close() error {
+	err := l.closeFile()
+	l.compressing.Wait()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		err = l.err
+	}
+	return err
+}
+
+// compress replaces the file 'name' by the gzip compressed file name.gz
+func compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(name)
+	_, err = io.Copy(zw, in)
+	if err2 := zw.Close(); err == nil {
+		err = err2
+	}
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	in.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,182 @@
+package measlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ident"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/marker"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "measlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDaily(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := New(dir, "loc", Options{Format: CSV, Daily: true, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	midnight := time.Date(2020, 5, 18, 0, 0, 0, 0, time.UTC)
+	for i := -2; i < 3; i++ {
+		m := Record{Meas: ils.Meas{DDM: float32(i) / 10, SDM: 40, RF: -6, Ident: identAt(i)}}
+		if err := l.Log(midnight.Add(time.Duration(i)*300*time.Millisecond), "ok", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	want := []string{filepath.Join(dir, "loc_20200517T235959.400Z.csv.gz"), filepath.Join(dir, "loc_20200518T000000.000Z.csv.gz")}
+	if len(files) != 2 || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("got files %v, want %v", files, want)
+	}
+	var records [][]string
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := csv.NewReader(zr).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) == 0 || len(r[0]) != len(Columns) || r[0][0] != "time" {
+			t.Fatalf("%s: header %v, want %v", name, r, Columns)
+		}
+		records = append(records, r[1:]...)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+	if got := records[1]; got[0] != "2020-05-17T23:59:59.7Z" || got[1] != "ok" || got[2] != "-6" || got[3] != "-0.1" ||
+		got[4] != "40" || got[13] != "" || records[4][13] != "IFBS" {
+		t.Errorf("got records %v", records)
+	}
+}
+
+func identAt(i int) ident.Ident {
+	if i == 2 {
+		return ident.Ident{Text: "IFBS", Depth: 10}
+	}
+	return ident.Ident{}
+}
+
+func TestSize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := New(dir, "gp", Options{Format: JSONL, MaxSize: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		if err := l.Log(start.Add(time.Duration(i)*100*time.Millisecond), "reconnecting", Record{Meas: ils.Meas{DDM: float32(i)}, Marker: &marker.Meas{Mod400: float32(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "gp_*.jsonl"))
+	if len(files) < 2 {
+		t.Fatalf("got files %v, want more than one", files)
+	}
+	n := 0
+	for i, name := range files {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := bufio.NewScanner(f)
+		last := 0
+		for s.Scan() {
+			var line struct {
+				Time   time.Time   `json:"time"`
+				Status string      `json:"status"`
+				DDM    float32     `json:"ddm"`
+				Marker marker.Meas `json:"marker"`
+			}
+			if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			if !line.Time.Equal(start.Add(time.Duration(n)*100*time.Millisecond)) || line.DDM != float32(n) || line.Marker.Mod400 != float32(n) || line.Status != "reconnecting" {
+				t.Errorf("line %d at %v with DDM %g, 400 Hz %g%%, status %s", n, line.Time, line.DDM, line.Marker.Mod400, line.Status)
+			}
+			last = len(s.Bytes()) + 1
+			n++
+		}
+		f.Close()
+		// A new file is started after the line which reaches the limit
+		if fi.Size()-int64(last) >= 500 || (i < len(files)-1 && fi.Size() < 500) {
+			t.Errorf("%s: %d bytes, last line of %d bytes", name, fi.Size(), last)
+		}
+	}
+	if n != 10 {
+		t.Errorf("got %d lines, want 10", n)
+	}
+}
+
+func TestSameMillisecond(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Each line starts a new file
+	l, err := New(dir, "loc", Options{Format: CSV, MaxSize: 1, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := l.Log(start, "ok", Record{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	want := []string{"loc_20200517T102030.000Z.csv.gz", "loc_20200517T102030.000Z_1.csv.gz", "loc_20200517T102030.000Z_2.csv.gz"}
+	if len(files) != len(want) {
+		t.Fatalf("got files %v, want %v", files, want)
+	}
+	for i, name := range files {
+		if filepath.Base(name) != want[i] {
+			t.Errorf("got file %s, want %s", filepath.Base(name), want[i])
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if _, err := New(".", "loc", Options{Format: "xml"}); err == nil {
+		t.Error("no error for an unknown format")
+	}
+}
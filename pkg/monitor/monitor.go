@@ -0,0 +1,261 @@
+// Package monitor raises alarms when the measurements of a source are out of
+// tolerance, like the executive monitor of an ILS.
+//
+// Each Rule is a window of allowed values of a measurement. A rule goes to
+// the alarm state when the measurement has been outside the window for the
+// persistence time, and back to normal when it has been inside the window
+// narrowed by the hysteresis for the persistence time. While no measurements
+// are made, the rules go to the alarm state after the persistence time.
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// States of a rule
+const (
+	Normal = "normal"
+	Alarm  = "alarm"
+)
+
+// MaxEvents is the number of state changes kept by a Monitor
+const MaxEvents = 100
+
+// DDM in percent of a full scale (150 µA) deflection of the course deviation indicator
+const (
+	LocalizerFullScale = 15.5
+	GlidePathFullScale = 17.5
+)
+
+// Fields are the measurements monitored by the rules
+var Fields = map[string]func(m *ils.Meas) float32{
+	"ddm":    func(m *ils.Meas) float32 { return m.DDM },
+	"sdm":    func(m *ils.Meas) float32 { return m.SDM },
+	"rf":     func(m *ils.Meas) float32 { return m.RF },
+	"mod90":  func(m *ils.Meas) float32 { return m.Mod90 },
+	"mod150": func(m *ils.Meas) float32 { return m.Mod150 },
+	"offset": func(m *ils.Meas) float32 { return m.Offset },
+	"phase":  func(m *ils.Meas) float32 { return m.Phase },
+	"ident":  func(m *ils.Meas) float32 { return m.Ident.Depth },
+}
+
+// Rule is the window of allowed values of a measurement
+type Rule struct {
+	Name        string   `json:"name"`          // Name of the alarm, the field if empty
+	Field       string   `json:"field"`         // One of Fields
+	Min         *float64 `json:"min,omitempty"` // No lower limit if nil
+	Max         *float64 `json:"max,omitempty"` // No upper limit if nil
+	Hysteresis  float64  `json:"hysteresis"`    // Margin inside the limits to return to normal
+	Persistence float64  `json:"persistence"`   // Seconds before a state change
+}
+
+// Validate checks that the rule can raise and clear an alarm
+func (r Rule) Validate() error {
+	switch {
+	case Fields[r.Field] == nil:
+		return fmt.Errorf("rule '%s': unknown field '%s'", r.Name, r.Field)
+	case r.Min == nil && r.Max == nil:
+		return fmt.Errorf("rule '%s': no limits", r.Name)
+	case !(r.Hysteresis >= 0) || !(r.Persistence >= 0):
+		return fmt.Errorf("rule '%s': hysteresis and persistence must not be negative", r.Name)
+	case r.Min != nil && r.Max != nil && !(*r.Min+r.Hysteresis <= *r.Max-r.Hysteresis):
+		return fmt.Errorf("rule '%s': the window between min and max is narrower than the hysteresis", r.Name)
+	}
+	return nil
+}
+
+// String describes the limits of the rule
+func (r Rule) String() string {
+	switch {
+	case r.Min == nil:
+		return fmt.Sprintf("%s <= %.4g", r.Field, *r.Max)
+	case r.Max == nil:
+		return fmt.Sprintf("%s >= %.4g", r.Field, *r.Min)
+	}
+	return fmt.Sprintf("%.4g <= %s <= %.4g", *r.Min, r.Field, *r.Max)
+}
+
+// outside returns true if 'v' is outside the limits moved inwards by 'margin'
+func (r Rule) outside(v, margin float64) bool {
+	return math.IsNaN(v) || (r.Min != nil && v < *r.Min+margin) || (r.Max != nil && v > *r.Max-margin)
+}
+
+// limit returns a pointer to 'v' for the limits of a Rule
+func limit(v float64) *float64 {
+	return &v
+}
+
+// Localizer returns the rules of a localizer: DDM within ±15 µA of the
+// course line, SDM within 36-44% and RF level above -30 dBFS. The RF level
+// depends on the receiver and must be adjusted.
+func Localizer() []Rule {
+	ddm := 15 * LocalizerFullScale / 150
+	return []Rule{
+		{Name: "ddm", Field: "ddm", Min: limit(-ddm), Max: limit(ddm), Hysteresis: 0.1, Persistence: 5},
+		{Name: "sdm", Field: "sdm", Min: limit(36), Max: limit(44), Hysteresis: 0.5, Persistence: 5},
+		{Name: "rf", Field: "rf", Min: limit(-30), Hysteresis: 1, Persistence: 5},
+	}
+}
+
+// Ident returns the rule of the ident of a localizer which keys an
+// identifier: ident depth above 5%
+func Ident() Rule {
+	return Rule{Name: "ident", Field: "ident", Min: limit(5), Hysteresis: 1, Persistence: 10}
+}
+
+// GlidePath returns the rules of a glide path: DDM within ±47 µA (a shift
+// of 7.5% of the path angle with a half sector of 0.12 of the angle), SDM
+// within 75-85% and RF level above -30 dBFS
+func GlidePath() []Rule {
+	ddm := 47 * GlidePathFullScale / 150
+	return []Rule{
+		{Name: "ddm", Field: "ddm", Min: limit(-ddm), Max: limit(ddm), Hysteresis: 0.2, Persistence: 5},
+		{Name: "sdm", Field: "sdm", Min: limit(75), Max: limit(85), Hysteresis: 0.5, Persistence: 5},
+		{Name: "rf", Field: "rf", Min: limit(-30), Hysteresis: 1, Persistence: 5},
+	}
+}
+
+// State is the state of a rule
+type State struct {
+	Rule  string    `json:"rule"`
+	State string    `json:"state"` // Normal or Alarm
+	Since time.Time `json:"since"` // When the state was entered
+	Value float32   `json:"value"` // Last value of the measurement
+}
+
+// Event is a state change of a rule
+type Event struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Rule   string    `json:"rule"`
+	State  string    `json:"state"`          // The new state
+	Value  float32   `json:"value"`          // The measurement which changed the state
+	Lost   bool      `json:"lost,omitempty"` // No measurements were made, Value is the last one
+	Limits string    `json:"limits"`
+}
+
+func (e Event) String() string {
+	if e.Lost {
+		return fmt.Sprintf("%s %s %s: no measurements, limits %s", e.Source, e.Rule, e.State, e.Limits)
+	}
+	return fmt.Sprintf("%s %s %s: %.4g, limits %s", e.Source, e.Rule, e.State, e.Value, e.Limits)
+}
+
+// Monitor checks the measurements of a source against the rules.
+// It is not safe for concurrent use.
+type Monitor struct {
+	source  string
+	rules   []Rule
+	states  []State
+	pending []time.Time // when the measurement first called for a state change, zero if not
+	events  []Event
+}
+
+// New creates a Monitor of 'source'. All rules start in the normal state.
+func New(source string, rules []Rule) (*Monitor, error) {
+	m := &Monitor{source: source, rules: make([]Rule, len(rules)), states: make([]State, len(rules)),
+		pending: make([]time.Time, len(rules))}
+	names := map[string]bool{}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = r.Field
+		}
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule '%s' defined twice", r.Name)
+		}
+		names[r.Name] = true
+		m.rules[i] = r
+		m.states[i] = State{Rule: r.Name, State: Normal}
+	}
+	return m, nil
+}
+
+// Rules returns the rules of the Monitor
+func (m *Monitor) Rules() []Rule {
+	return append([]Rule{}, m.rules...)
+}
+
+// Check updates the states with the measurements 'meas' made at time 't'
+// and returns the state changes
+func (m *Monitor) Check(t time.Time, meas *ils.Meas) []Event {
+	return m.check(t, meas)
+}
+
+// Lost updates the states at time 't' while no measurements are made, e.g.
+// while the source reconnects, and returns the state changes. The
+// measurements are taken as out of tolerance.
+func (m *Monitor) Lost(t time.Time) []Event {
+	return m.check(t, nil)
+}
+
+// check updates the states with 'meas', or as lost if nil
+func (m *Monitor) check(t time.Time, meas *ils.Meas) []Event {
+	var events []Event
+	lost := meas == nil
+	for i, r := range m.rules {
+		s := &m.states[i]
+		if !lost {
+			s.Value = Fields[r.Field](meas)
+		}
+		if s.Since.IsZero() {
+			s.Since = t
+		}
+		var change bool
+		if s.State == Normal {
+			change = lost || r.outside(float64(s.Value), 0)
+		} else {
+			change = !lost && !r.outside(float64(s.Value), r.Hysteresis)
+		}
+		if !change {
+			m.pending[i] = time.Time{}
+			continue
+		}
+		if m.pending[i].IsZero() {
+			m.pending[i] = t
+		}
+		if t.Sub(m.pending[i]).Seconds() < r.Persistence {
+			continue
+		}
+		if s.State == Normal {
+			s.State = Alarm
+		} else {
+			s.State = Normal
+		}
+		s.Since = t
+		m.pending[i] = time.Time{}
+		events = append(events, Event{Time: t, Source: m.source, Rule: r.Name, State: s.State, Value: s.Value, Lost: lost, Limits: r.String()})
+	}
+	m.events = append(m.events, events...)
+	if len(m.events) > MaxEvents {
+		m.events = append([]Event{}, m.events[len(m.events)-MaxEvents:]...)
+	}
+	return events
+}
+
+// States returns the state of each rule
+func (m *Monitor) States() []State {
+	return append([]State{}, m.states...)
+}
+
+// Active returns the names of the rules in the alarm state
+func (m *Monitor) Active() []string {
+	var names []string
+	for _, s := range m.states {
+		if s.State == Alarm {
+			names = append(names, s.Rule)
+		}
+	}
+	return names
+}
+
+// Events returns the last MaxEvents state changes, the oldest first
+func (m *Monitor) Events() []Event {
+	return append([]Event{}, m.events...)
+}
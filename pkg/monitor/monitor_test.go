@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/ident"
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+func TestCheck(t *testing.T) {
+	m, err := New("loc", []Rule{{Field: "ddm", Min: limit(-1.5), Max: limit(1.5), Hysteresis: 0.2, Persistence: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	// DDM every 100 ms
+	ddm := []float32{
+		0, 2, 0, // a spike is ignored
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, // alarm after 1 s
+		1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, 1.4, // inside the hysteresis
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // normal after 1 s
+	}
+	var events []Event
+	for i, v := range ddm {
+		events = append(events, m.Check(start.Add(time.Duration(i)*100*time.Millisecond), &ils.Meas{DDM: v})...)
+		if i == 13 && !reflect.DeepEqual(m.Active(), []string{"ddm"}) {
+			t.Errorf("active alarms %v, want [ddm]", m.Active())
+		}
+	}
+	want := []Event{
+		{Time: start.Add(1300 * time.Millisecond), Source: "loc", Rule: "ddm", State: Alarm, Value: 2, Limits: "-1.5 <= ddm <= 1.5"},
+		{Time: start.Add(3600 * time.Millisecond), Source: "loc", Rule: "ddm", State: Normal, Value: 1, Limits: "-1.5 <= ddm <= 1.5"},
+	}
+	if !reflect.DeepEqual(events, want) || !reflect.DeepEqual(m.Events(), want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	if s := m.States()[0]; s.State != Normal || !s.Since.Equal(want[1].Time) || len(m.Active()) != 0 {
+		t.Errorf("state %+v, active %v", s, m.Active())
+	}
+	if got := events[0].String(); got != "loc ddm alarm: 2, limits -1.5 <= ddm <= 1.5" {
+		t.Errorf("event %s", got)
+	}
+
+	// A lost measurement is out of tolerance
+	m.Check(start.Add(time.Hour), &ils.Meas{DDM: float32(math.NaN())})
+	m.Check(start.Add(time.Hour+time.Second), &ils.Meas{DDM: float32(math.NaN())})
+	if !reflect.DeepEqual(m.Active(), []string{"ddm"}) {
+		t.Errorf("active alarms %v with NaN, want [ddm]", m.Active())
+	}
+}
+
+func TestLost(t *testing.T) {
+	m, err := New("loc", []Rule{{Field: "ddm", Min: limit(-1.5), Max: limit(1.5), Persistence: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 5, 17, 10, 20, 30, 0, time.UTC)
+	m.Check(start, &ils.Meas{DDM: 0.5})
+	// No measurements for 2 s, then in tolerance again for 1 s
+	var events []Event
+	for i := 1; i <= 5; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		if i <= 2 {
+			events = append(events, m.Lost(at)...)
+		} else {
+			events = append(events, m.Check(at, &ils.Meas{DDM: 0.5})...)
+		}
+	}
+	want := []Event{
+		{Time: start.Add(2 * time.Second), Source: "loc", Rule: "ddm", State: Alarm, Value: 0.5, Lost: true, Limits: "-1.5 <= ddm <= 1.5"},
+		{Time: start.Add(4 * time.Second), Source: "loc", Rule: "ddm", State: Normal, Value: 0.5, Limits: "-1.5 <= ddm <= 1.5"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	if got := events[0].String(); got != "loc ddm alarm: no measurements, limits -1.5 <= ddm <= 1.5" {
+		t.Errorf("event %s", got)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	for _, c := range []struct {
+		rules []Rule
+		meas  ils.Meas
+	}{
+		{append(Localizer(), Ident()), ils.Meas{SDM: 40, RF: -6, Ident: ident.Ident{Depth: 10}}},
+		{GlidePath(), ils.Meas{SDM: 80, RF: -6}},
+	} {
+		m, err := New("loc", c.rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		for i := 0; i <= 100; i++ {
+			m.Check(start.Add(time.Duration(i)*100*time.Millisecond), &c.meas)
+		}
+		if len(m.Events()) != 0 {
+			t.Errorf("events %v of a nominal signal", m.Events())
+		}
+	}
+	m, _ := New("loc", append(Localizer(), Ident()))
+	start := time.Now()
+	for i := 0; i <= 50; i++ {
+		m.Check(start.Add(time.Duration(i)*100*time.Millisecond), &ils.Meas{DDM: 1.6, SDM: 40, RF: -6, Ident: ident.Ident{Depth: 10}})
+	}
+	if !reflect.DeepEqual(m.Active(), []string{"ddm"}) {
+		t.Errorf("active alarms %v at 15.5 µA after 5 s, want [ddm]", m.Active())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, rules := range [][]Rule{
+		{{Field: "bearing", Min: limit(0)}},
+		{{Field: "ddm"}},
+		{{Field: "ddm", Min: limit(1), Max: limit(-1)}},
+		{{Field: "ddm", Min: limit(-1), Max: limit(1), Hysteresis: 1.5}},
+		{{Field: "ddm", Max: limit(1), Persistence: -1}},
+		{{Field: "ddm", Max: limit(1)}, {Field: "ddm", Min: limit(-1)}},
+	} {
+		if _, err := New("loc", rules); err == nil {
+			t.Errorf("no error for %+v", rules)
+		}
+	}
+}
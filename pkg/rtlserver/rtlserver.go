@@ -0,0 +1,265 @@
+// Package rtlserver implements the server side of the rtl_tcp protocol. It
+// streams the samples of a SampleSource instead of a dongle, so srvils and
+// dumpils can be tested and demonstrated without hardware.
+//
+// An rtl_tcp client receives a 12 byte header with the magic "RTL0", the
+// tuner type and the number of gain values, followed by a stream of unsigned
+// 8-bit IQ pairs. The client sends 5 byte commands: a command number and a
+// big-endian 32-bit parameter.
+package rtlserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+// Commands defined in rtl_tcp.c
+const (
+	CmdCenterFreq = iota + 1
+	CmdSampleRate
+	CmdGainMode
+	CmdGain
+	CmdFreqCorrection
+	CmdIFGain
+	CmdTestMode
+	CmdAGCMode
+	CmdDirectSampling
+	CmdOffsetTuning
+	CmdRTLXtalFreq
+	CmdTunerXtalFreq
+	CmdGainByIndex
+	CmdBiasTee
+)
+
+// Tuner types reported in the header
+const (
+	TunerE4000 = 1
+	TunerR820T = 5
+)
+
+// gainCount is the number of gain values of the R820T
+const gainCount = 29
+
+// blockSize is the number of samples sent at a time
+const blockSize = 8192
+
+// Settings holds the dongle settings sent by the client
+type Settings struct {
+	CenterFreq     uint32
+	SampleRate     uint32
+	ManualGain     bool  // Tuner gain mode, false for automatic gain
+	Gain           int32 // Tuner gain in tenths of a dB
+	FreqCorrection int32 // ppm
+	AGC            bool  // RTL2832 digital AGC
+	DirectSampling uint32
+	OffsetTuning   bool
+	BiasTee        bool
+}
+
+// Command is a command received from the client
+type Command struct {
+	Cmd   uint8
+	Param uint32
+}
+
+// Server streams the samples of a source to one rtl_tcp client at a time.
+// Center frequency and gain commands are passed on to the source.
+type Server struct {
+	src      source.SampleSource
+	tuner    uint32
+	commands chan<- Command
+
+	mu       sync.Mutex
+	settings Settings
+	listener net.Listener
+	conn     net.Conn
+}
+
+// New creates a server for the samples of 'src' which reports an R820T tuner
+func New(src source.SampleSource) *Server {
+	return &Server{src: src, tuner: TunerR820T}
+}
+
+// Notify sends the commands received from the clients to 'c' for testing.
+// Commands are dropped if 'c' is full.
+func (s *Server) Notify(c chan<- Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = c
+}
+
+// Settings returns the settings sent by the clients
+func (s *Server) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+// ListenAndServe listens on the TCP address 'addr' and serves clients until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the clients connecting to 'l' one at a time until Close is
+// called or the source fails
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Printf("rtl_tcp client %s connected", conn.RemoteAddr())
+		err = s.serveConn(conn)
+		log.Printf("rtl_tcp client %s disconnected: %v", conn.RemoteAddr(), err)
+		if err != nil && !isConnError(err) {
+			return err
+		}
+	}
+}
+
+// Close stops the server and disconnects the client
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Disconnect closes the connection to the current client, like a network failure
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// connError wraps errors of the client connection
+type connError struct{ error }
+
+func isConnError(err error) bool {
+	var ce connError
+	return errors.As(err, &ce)
+}
+
+// serveConn sends the header and the samples to a client and handles its commands
+func (s *Server) serveConn(conn net.Conn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	var header [12]byte
+	copy(header[:], "RTL0")
+	binary.BigEndian.PutUint32(header[4:], s.tuner)
+	binary.BigEndian.PutUint32(header[8:], gainCount)
+	if _, err := conn.Write(header[:]); err != nil {
+		return connError{err}
+	}
+
+	go func() {
+		var buf [5]byte
+		for {
+			if _, err := io.ReadFull(conn, buf[:]); err != nil {
+				conn.Close() // stops the samples
+				return
+			}
+			s.command(Command{Cmd: buf[0], Param: binary.BigEndian.Uint32(buf[1:])})
+		}
+	}()
+
+	format, err := iq.LookupFormat(s.src.Metadata().Format)
+	if err != nil {
+		return err
+	}
+	raw := make([]byte, blockSize*format.Size)
+	samples := make([]complex64, blockSize)
+	out := make([]byte, blockSize*2)
+	for {
+		if err := s.src.Read(raw); err != nil {
+			return err
+		}
+		if format.Name == iq.CU8.Name {
+			copy(out, raw)
+		} else {
+			format.Decode(samples, raw)
+			iq.EncodeCU8(out, samples)
+		}
+		if _, err := conn.Write(out); err != nil {
+			return connError{err}
+		}
+	}
+}
+
+// command applies a command received from the client
+func (s *Server) command(c Command) {
+	s.mu.Lock()
+	st := &s.settings
+	switch c.Cmd {
+	case CmdCenterFreq:
+		st.CenterFreq = c.Param
+	case CmdSampleRate:
+		st.SampleRate = c.Param
+	case CmdGainMode:
+		st.ManualGain = c.Param != 0
+	case CmdGain:
+		st.Gain = int32(c.Param)
+	case CmdFreqCorrection:
+		st.FreqCorrection = int32(c.Param)
+	case CmdAGCMode:
+		st.AGC = c.Param != 0
+	case CmdDirectSampling:
+		st.DirectSampling = c.Param
+	case CmdOffsetTuning:
+		st.OffsetTuning = c.Param != 0
+	case CmdBiasTee:
+		st.BiasTee = c.Param != 0
+	}
+	if s.commands != nil {
+		select {
+		case s.commands <- c:
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	var err error
+	switch c.Cmd {
+	case CmdCenterFreq:
+		err = s.src.Tune(float64(c.Param))
+	case CmdGain:
+		err = s.src.SetGain(float64(int32(c.Param)) / 10)
+	case CmdSampleRate:
+		if rate := s.src.Metadata().SampleRate; rate != float64(c.Param) {
+			log.Printf("rtl_tcp client requested %d S/s, the samples are at %.0f S/s", c.Param, rate)
+		}
+	}
+	if err != nil {
+		log.Printf("rtl_tcp command %d %d: %v", c.Cmd, c.Param, err)
+	}
+}
@@ -0,0 +1,183 @@
+package rtlserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/siggen"
+	"github.com/asgaut/dumpils/pkg/source"
+)
+
+// start serves 'src' on a local port and returns the server and its address
+func start(t *testing.T, src source.SampleSource) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(src)
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func TestProtocol(t *testing.T) {
+	sim := source.NewSim(source.Options{SampleRate: 1e6})
+	sim.SetSamples([]byte{1, 2, 3, 4})
+	s, addr := start(t, sim)
+	defer s.Close()
+	commands := make(chan Command, 100)
+	s.Notify(commands)
+
+	// The header
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header [12]byte
+	if _, err := conn.Read(header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(header[:], []byte{'R', 'T', 'L', '0', 0, 0, 0, TunerR820T, 0, 0, 0, gainCount}) {
+		t.Errorf("header %v", header)
+	}
+	conn.Close()
+
+	// The commands sent by the client
+	client, err := source.NewRTLTCP(addr, source.Options{SampleRate: 2.048e6, Center: 109.7e6, Gain: 40.2, PPM: -3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	block := make([]byte, 10)
+	if err := client.Read(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block, []byte{1, 2, 3, 4, 1, 2, 3, 4, 1, 2}) {
+		t.Errorf("received %v", block)
+	}
+	for c := range commands {
+		if c.Cmd == CmdCenterFreq {
+			break
+		}
+	}
+	want := Settings{CenterFreq: 109700000, SampleRate: 2048000, ManualGain: true, Gain: 402, FreqCorrection: -3}
+	if got := s.Settings(); got != want {
+		t.Errorf("settings %+v, want %+v", got, want)
+	}
+	if m := sim.Metadata(); m.CenterFrequency != 109.7e6 || m.Gain != 40.2 {
+		t.Errorf("source tuned to %.0f Hz with %.1f dB gain", m.CenterFrequency, m.Gain)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtlserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 16-bit samples are converted to 8-bit samples
+	name := filepath.Join(dir, "capture.cs16le")
+	data := make([]byte, blockSize*4)
+	for i := 0; i < blockSize; i++ {
+		binary.LittleEndian.PutUint16(data[4*i:], uint16(16384))
+		binary.LittleEndian.PutUint16(data[4*i+2:], uint16(0x10000-32768))
+	}
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := source.NewFile(name, source.Options{SampleRate: 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, addr := start(t, file)
+	defer s.Close()
+
+	client, err := source.NewRTLTCP(addr, source.Options{SampleRate: 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	block := make([]byte, blockSize*2)
+	if err := client.Read(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block, bytes.Repeat([]byte{191, 0}, blockSize)) {
+		t.Errorf("received %v..., want [191 0 ...]", block[:8])
+	}
+}
+
+// TestEndToEnd demodulates a localizer signal received over rtl_tcp and
+// checks that the client reconnects when the connection is lost
+func TestEndToEnd(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3}
+	sim := source.NewSim(source.Options{SampleRate: cfg.SampleRate})
+	g, err := siggen.New(cfg.SampleRate, cfg.Offset, siggen.Params{Carrier: siggen.Carrier{DDM: 10, SDM: 50, RF: -6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetGenerator(g)
+	s, addr := start(t, sim)
+	defer s.Close()
+
+	src, err := source.Open("rtltcp://"+addr, source.Options{SampleRate: cfg.SampleRate, Center: 109.5e6, Gain: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	d, err := ils.New("demod2", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, cfg.BlockSize()*2)
+	samples := make([]complex64, cfg.BlockSize())
+	measure := func() ils.Meas {
+		var m ils.Meas
+		for i := 0; i < 3; i++ {
+			if err := src.Read(raw); err != nil {
+				t.Fatal(err)
+			}
+			iq.DecodeCU8(samples, raw)
+			if m, err = d.Process(samples); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return m
+	}
+
+	m := measure()
+	t.Logf("DDM %.2f%%, SDM %.2f%%, RF %.1f dBFS", m.DDM, m.SDM, m.RF)
+	if math.Abs(float64(m.DDM)-10) > 0.2 || math.Abs(float64(m.SDM)-50) > 0.5 {
+		t.Errorf("DDM %.2f%%, SDM %.2f%%, want 10%% and 50%%", m.DDM, m.SDM)
+	}
+
+	// The client reconnects after the connection is lost and the samples
+	// buffered before the loss are read
+	s.Disconnect()
+	time.Sleep(100 * time.Millisecond)
+	s.command(Command{Cmd: CmdCenterFreq}) // forget the frequency set by the client
+	c := src.(source.Connection)
+	for i := 0; i < 100 && c.Reconnects() == 0; i++ {
+		if err := src.Read(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Status() != source.StatusOK || c.Reconnects() != 1 {
+		t.Errorf("status %s after %d reconnects, want ok after 1", c.Status(), c.Reconnects())
+	}
+	m = measure()
+	if math.Abs(float64(m.DDM)-10) > 0.2 {
+		t.Errorf("DDM %.2f%% after reconnecting, want 10%%", m.DDM)
+	}
+	if f := s.Settings().CenterFreq; f != 109500000 {
+		t.Errorf("center frequency %d Hz after reconnecting, want 109500000 Hz", f)
+	}
+}
@@ -0,0 +1,259 @@
+// Package siggen synthesizes ILS localizer and glide path signals for the
+// simulator source of srvils, fakertl and the tests of the demodulators.
+//
+// The signal is one or two carriers amplitude modulated with the 90 and 150 Hz
+// navigation tones, optionally keyed with a Morse identifier on the 1020 Hz
+// tone, with a reflection (multipath) and white noise added:
+//
+//	g, err := siggen.New(1310720, 200e3, siggen.Localizer())
+//	g.Generate(samples) // the next len(samples) samples
+package siggen
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/asgaut/dumpils/pkg/ident"
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// identPeriod is the time in seconds from the start of one identifier to the
+// next, i.e. six per minute, unless the identifier takes longer to key
+const identPeriod = 10.0
+
+// Carrier describes a carrier modulated with the navigation tones
+type Carrier struct {
+	DDM    float64 `json:"ddm"`    // Difference in depth of modulation in percent, positive for 150 Hz predominance
+	SDM    float64 `json:"sdm"`    // Sum of the depths of modulation in percent
+	RF     float64 `json:"rf"`     // Carrier level in dBFS
+	Offset float64 `json:"offset"` // Carrier frequency relative to the channel frequency in Hz
+	Phase  float64 `json:"phase"`  // Phase of the 150 Hz tone relative to the 90 Hz tone in degrees of 150 Hz
+}
+
+// Multipath describes a reflection of the carriers
+type Multipath struct {
+	Delay float64 `json:"delay"` // Delay relative to the direct signal in µs
+	Level float64 `json:"level"` // Level relative to the direct signal in dB
+	Phase float64 `json:"phase"` // Carrier phase relative to the direct signal in degrees
+}
+
+// Params describes the synthesized signal
+type Params struct {
+	Carrier               // Course carrier, or the only carrier of a single frequency system
+	Second     *Carrier   `json:"second,omitempty"`    // Clearance or interfering carrier, nil for none
+	Ident      string     `json:"ident"`               // Identifier keyed on the course carrier, "" for none
+	IdentDepth float64    `json:"identDepth"`          // Modulation depth of the ident tone in percent
+	WPM        float64    `json:"wpm"`                 // Keying speed of the identifier in words per minute
+	Noise      float64    `json:"noise"`               // RMS level of the white noise in dBFS, 0 for no noise
+	Multipath  *Multipath `json:"multipath,omitempty"` // Reflection of the carriers, nil for none
+}
+
+// Localizer returns the parameters of a localizer on the course line
+func Localizer() Params {
+	return Params{Carrier: Carrier{SDM: 40, RF: -6}, IdentDepth: 10, WPM: 7}
+}
+
+// GlidePath returns the parameters of a glide path on the glide slope
+func GlidePath() Params {
+	return Params{Carrier: Carrier{SDM: 80, RF: -6}}
+}
+
+// Validate checks that the signal can be synthesized at the sample rate 'fs'
+// with the channel 'offset' Hz from the center frequency
+func (p Params) Validate(fs, offset float64) error {
+	carriers := []Carrier{p.Carrier}
+	if p.Second != nil {
+		carriers = append(carriers, *p.Second)
+	}
+	for _, c := range carriers {
+		switch {
+		case !(c.SDM >= 0 && c.SDM <= 100):
+			return fmt.Errorf("SDM %g%% must be between 0 and 100%%", c.SDM)
+		case !(math.Abs(c.DDM) <= c.SDM):
+			return fmt.Errorf("DDM %g%% must not exceed the SDM %g%%", c.DDM, c.SDM)
+		case !(c.RF <= 6 && c.RF >= ils.NoSignal):
+			return fmt.Errorf("RF level %g dBFS must be between %g and 6 dBFS", c.RF, ils.NoSignal)
+		case !(math.Abs(offset+c.Offset) < fs/2):
+			return fmt.Errorf("carrier offset %g Hz is outside the sampled bandwidth", c.Offset)
+		case math.IsNaN(c.Phase) || math.IsInf(c.Phase, 0):
+			return fmt.Errorf("invalid phase %g", c.Phase)
+		}
+	}
+	for i := 0; i < len(p.Ident); i++ {
+		if c := strings.ToUpper(p.Ident)[i]; c != ' ' && ident.Code(c) == "" {
+			return fmt.Errorf("identifier '%s' has no Morse code for '%c'", p.Ident, c)
+		}
+	}
+	if p.Ident != "" && !(p.WPM > 0 && p.WPM <= 100) {
+		return fmt.Errorf("keying speed %g WPM must be between 0 and 100 WPM", p.WPM)
+	}
+	if !(p.IdentDepth >= 0 && p.IdentDepth <= 100) {
+		return fmt.Errorf("ident depth %g%% must be between 0 and 100%%", p.IdentDepth)
+	}
+	if !(p.Noise <= 0 && p.Noise >= ils.NoSignal) {
+		return fmt.Errorf("noise level %g dBFS must be between %g and 0 dBFS", p.Noise, ils.NoSignal)
+	}
+	if m := p.Multipath; m != nil && (!(m.Delay >= 0 && m.Delay <= 1e6) || !(m.Level <= 0 && m.Level >= ils.NoSignal) ||
+		math.IsNaN(m.Phase) || math.IsInf(m.Phase, 0)) {
+		return fmt.Errorf("invalid multipath %+v, the delay must be 0 to 1 s and the level %g to 0 dB", *m, ils.NoSignal)
+	}
+	return nil
+}
+
+// Generator synthesizes the signal described by Params. Successive blocks of
+// samples are continuous, also when the parameters are changed.
+type Generator struct {
+	fs     float64
+	offset float64
+	rng    *rand.Rand
+
+	mu     sync.Mutex
+	params Params
+	keying []bool  // key down state of each dot of the ident cycle
+	dot    float64 // dot duration in seconds
+	n      int64   // number of samples generated
+}
+
+// New creates a Generator of samples at 'fs' Hz with the channel 'offset' Hz
+// from the center frequency
+func New(fs, offset float64, p Params) (*Generator, error) {
+	g := &Generator{fs: fs, offset: offset, rng: rand.New(rand.NewSource(1))}
+	if err := g.SetParams(p); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Params returns the parameters of the signal
+func (g *Generator) Params() Params {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.params
+}
+
+// SetParams changes the signal from the next call to Generate
+func (g *Generator) SetParams(p Params) error {
+	if err := p.Validate(g.fs, g.offset); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.params = p
+	g.keying = nil
+	if p.Ident != "" && p.IdentDepth > 0 {
+		g.dot = 1.2 / p.WPM // PARIS timing
+		g.keying = keying(strings.ToUpper(p.Ident), int(math.Ceil(identPeriod/g.dot)))
+	}
+	return nil
+}
+
+// keying returns the key down state for each dot long time slot of the
+// identifier 'text' after a word space, followed by at least a word space up
+// to 'slots' slots
+func keying(text string, slots int) []bool {
+	k := make([]bool, 7)
+	for i := 0; i < len(text); i++ {
+		if text[i] == ' ' {
+			k = append(k, false, false, false, false) // word space after the letter space
+			continue
+		}
+		for _, e := range ident.Code(text[i]) {
+			k = append(k, true)
+			if e == '-' {
+				k = append(k, true, true)
+			}
+			k = append(k, false)
+		}
+		k = append(k, false, false) // letter space after the element space
+	}
+	k = append(k, make([]bool, 4)...)
+	if len(k) < slots {
+		k = append(k, make([]bool, slots-len(k))...)
+	}
+	return k
+}
+
+// keyed returns true if the ident tone is keyed at time 't'
+func (g *Generator) keyed(t float64) bool {
+	n := int64(len(g.keying))
+	i := int64(math.Floor(t/g.dot)) % n
+	if i < 0 {
+		i += n
+	}
+	return g.keying[i]
+}
+
+// Generate fills 'samples' with the next samples of the signal
+func (g *Generator) Generate(samples []complex64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range samples {
+		samples[i] = 0
+	}
+	t := float64(g.n) / g.fs
+	p := g.params
+	g.add(samples, t, p.Carrier, 1, true)
+	if p.Second != nil {
+		g.add(samples, t, *p.Second, 1, false)
+	}
+	if m := p.Multipath; m != nil {
+		gain := cmplx.Rect(math.Pow(10, m.Level/20), m.Phase*math.Pi/180)
+		g.add(samples, t-m.Delay*1e-6, p.Carrier, gain, true)
+		if p.Second != nil {
+			g.add(samples, t-m.Delay*1e-6, *p.Second, gain, false)
+		}
+	}
+	if p.Noise < 0 {
+		sigma := math.Pow(10, p.Noise/20) / math.Sqrt2 // in each of I and Q
+		for i := range samples {
+			samples[i] += complex64(complex(sigma*g.rng.NormFloat64(), sigma*g.rng.NormFloat64()))
+		}
+	}
+	g.n += int64(len(samples))
+}
+
+// osc is a complex oscillator
+type osc struct {
+	ph, step complex128
+}
+
+// newOsc returns an oscillator of 'f' Hz sampled at 'fs' Hz with the phase 'phase' radians at time 't'
+func newOsc(f, fs, t, phase float64) osc {
+	return osc{ph: cmplx.Rect(1, 2*math.Pi*math.Mod(f*t, 1)+phase), step: cmplx.Rect(1, 2*math.Pi*f/fs)}
+}
+
+// next returns the current value and advances one sample
+func (o *osc) next() complex128 {
+	v := o.ph
+	o.ph *= o.step
+	return v
+}
+
+// add adds the carrier 'c' from time 't', scaled by 'gain', to 'dst'.
+// The course carrier is keyed with the identifier.
+func (g *Generator) add(dst []complex64, t float64, c Carrier, gain complex128, course bool) {
+	a := gain * complex(math.Pow(10, c.RF/20), 0)
+	mod90 := (c.SDM - c.DDM) / 200
+	mod150 := (c.SDM + c.DDM) / 200
+	var modIdent float64
+	if course && g.keying != nil {
+		modIdent = g.params.IdentDepth / 100
+	}
+	carrier := newOsc(g.offset+c.Offset, g.fs, t, 0)
+	tone90 := newOsc(ils.Tone90, g.fs, t, 0)
+	tone150 := newOsc(ils.Tone150, g.fs, t, c.Phase*math.Pi/180)
+	toneIdent := newOsc(ident.Tone, g.fs, t, 0)
+	for i := range dst {
+		env := 1 + mod90*imag(tone90.next()) + mod150*imag(tone150.next())
+		if modIdent != 0 {
+			if v := imag(toneIdent.next()); g.keyed(t + float64(i)/g.fs) {
+				env += modIdent * v
+			}
+		}
+		dst[i] += complex64(a * complex(env, 0) * carrier.next())
+	}
+}
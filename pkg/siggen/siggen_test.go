@@ -0,0 +1,144 @@
+package siggen
+
+import (
+	"math"
+	"testing"
+
+	_ "github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// measure demodulates 'blocks' blocks of the signal 'p' with demod2
+func measure(t *testing.T, cfg ils.Config, p Params, blocks int) ils.Meas {
+	g, err := New(cfg.SampleRate, cfg.Offset, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ils.New("demod2", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]complex64, cfg.BlockSize())
+	var m ils.Meas
+	for i := 0; i < blocks; i++ {
+		g.Generate(samples)
+		if m, err = d.Process(samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestCarrier(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3}
+	tests := []struct {
+		p    Params
+		want ils.Meas
+	}{
+		{Localizer(), ils.Meas{SDM: 40, RF: -6}},
+		{GlidePath(), ils.Meas{SDM: 80, RF: -6}},
+		{Params{Carrier: Carrier{DDM: -15.5, SDM: 40, RF: -20, Offset: 1500, Phase: 10}}, ils.Meas{DDM: -15.5, SDM: 40, RF: -20, Offset: 1500, Phase: 10}},
+		{Params{Carrier: Carrier{DDM: 9.3, SDM: 20, RF: -3}, Noise: -40}, ils.Meas{DDM: 9.3, SDM: 20, RF: -3}},
+		// A reflection in antiphase at half the amplitude without delay halves the carrier
+		{Params{Carrier: Carrier{DDM: 5, SDM: 40, RF: -6}, Multipath: &Multipath{Level: -6.0206, Phase: 180}}, ils.Meas{DDM: 5, SDM: 40, RF: -12.02}},
+	}
+	for _, tc := range tests {
+		m := measure(t, cfg, tc.p, 3)
+		w := tc.want
+		if math.Abs(float64(m.DDM-w.DDM)) > 0.05 || math.Abs(float64(m.SDM-w.SDM)) > 0.2 || math.Abs(float64(m.RF-w.RF)) > 0.1 ||
+			math.Abs(float64(m.Offset-w.Offset)) > 5 || math.Abs(float64(m.Phase-w.Phase)) > 1 {
+			t.Errorf("%+v: DDM %.2f%%, SDM %.2f%%, RF %.2f dBFS, offset %.1f Hz, phase %.1f°, want %+v",
+				tc.p, m.DDM, m.SDM, m.RF, m.Offset, m.Phase, w)
+		}
+	}
+}
+
+func TestSecondCarrier(t *testing.T) {
+	cfg := ils.Config{SampleRate: 10.0 * float64(1<<17), Offset: 200e3}
+	p := Params{
+		Carrier: Carrier{SDM: 40, RF: -10, Offset: 4e3},
+		Second:  &Carrier{DDM: -20, SDM: 40, RF: -20, Offset: -4e3},
+	}
+	m := measure(t, cfg, p, 3)
+	if len(m.Carriers) != 2 {
+		t.Fatalf("got %d carriers, want 2", len(m.Carriers))
+	}
+	want := []ils.Carrier{
+		{Offset: -4e3, DDM: -20, SDM: 40, RF: -20},
+		{Offset: 4e3, DDM: 0, SDM: 40, RF: -10},
+	}
+	for i, c := range m.Carriers {
+		w := want[i]
+		if math.Abs(float64(c.Offset-w.Offset)) > 5 || math.Abs(float64(c.DDM-w.DDM)) > 0.2 ||
+			math.Abs(float64(c.SDM-w.SDM)) > 0.4 || math.Abs(float64(c.RF-w.RF)) > 0.2 {
+			t.Errorf("carrier %d: %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestIdent(t *testing.T) {
+	cfg := ils.Config{SampleRate: 250e3, Offset: 100e3}
+	p := Localizer()
+	p.Ident = "iosl"
+	p.WPM = 12
+	m := measure(t, cfg, p, 60)
+	t.Logf("%+v", m.Ident)
+	if m.Ident.Text != "IOSL" || math.Abs(float64(m.Ident.Depth)-10) > 1 || math.Abs(float64(m.Ident.WPM)-12) > 2 {
+		t.Errorf("ident %+v, want IOSL at 12 WPM and 10%%", m.Ident)
+	}
+}
+
+func TestContinuity(t *testing.T) {
+	p := Localizer()
+	p.Ident = "ABC"
+	p.Second = &Carrier{SDM: 40, RF: -20, Offset: 1234.5}
+	p.Multipath = &Multipath{Delay: 3, Level: -10, Phase: 45}
+	a, _ := New(1e6, 123e3, p)
+	b, _ := New(1e6, 123e3, p)
+	whole := make([]complex64, 100000)
+	a.Generate(whole)
+	parts := make([]complex64, len(whole))
+	b.Generate(parts[:333])
+	b.Generate(parts[333:])
+	for i := range whole {
+		if d := whole[i] - parts[i]; math.Abs(float64(real(d))) > 1e-5 || math.Abs(float64(imag(d))) > 1e-5 {
+			t.Fatalf("sample %d is %v in one block and %v in two", i, whole[i], parts[i])
+		}
+	}
+}
+
+func TestNoise(t *testing.T) {
+	g, err := New(1e6, 0, Params{Carrier: Carrier{RF: ils.NoSignal}, Noise: -20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]complex64, 100000)
+	g.Generate(samples)
+	var power float64
+	for _, v := range samples {
+		power += float64(real(v)*real(v) + imag(v)*imag(v))
+	}
+	if level := 10 * math.Log10(power/float64(len(samples))); math.Abs(level+20) > 0.1 {
+		t.Errorf("noise level %.2f dBFS, want -20 dBFS", level)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Params{
+		{Carrier: Carrier{SDM: 120}},
+		{Carrier: Carrier{DDM: 30, SDM: 20}},
+		{Carrier: Carrier{SDM: 40, RF: math.Inf(-1)}},
+		{Carrier: Carrier{SDM: 40, Offset: 500e3}},
+		{Carrier: Carrier{SDM: 40}, Second: &Carrier{SDM: 40, Offset: -800e3}},
+		{Carrier: Carrier{SDM: 40}, Ident: "ÆØÅ", WPM: 7},
+		{Carrier: Carrier{SDM: 40}, Ident: "ABC"},
+		{Carrier: Carrier{SDM: 40}, Noise: 3},
+		{Carrier: Carrier{SDM: 40}, Multipath: &Multipath{Delay: -1}},
+	} {
+		if _, err := New(1e6, 200e3, p); err == nil {
+			t.Errorf("no error for %+v", p)
+		} else {
+			t.Log(err)
+		}
+	}
+}
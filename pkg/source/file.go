@@ -0,0 +1,84 @@
+package source
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/asgaut/dumpils/pkg/iq"
+)
+
+// File reads samples from an IQ recording. The recording is repeated in real
+// time, or read once as fast as possible.
+type File struct {
+	file  *iq.File
+	once  bool
+	pacer *pacer
+	meta  iq.Metadata
+}
+
+// NewFile opens the IQ recording 'name'. The sample rate and center frequency
+// of the recording take precedence over the options.
+func NewFile(name string, opts Options) (*File, error) {
+	if len(name) > 2 && name[0] == '/' && name[2] == ':' {
+		name = name[1:] // file:///C:/capture.cu8
+	}
+	f, err := iq.Open(name, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	meta := f.Metadata
+	if meta.SampleRate == 0 {
+		meta.SampleRate = opts.SampleRate
+	}
+	if meta.CenterFrequency == 0 {
+		meta.CenterFrequency = opts.Center
+	}
+	if meta.SampleRate <= 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s: sample rate unknown", name)
+	}
+	return &File{file: f, once: opts.Once, pacer: newPacer(), meta: meta}, nil
+}
+
+// Read reads a block of samples. At the end of the recording it starts over,
+// or returns io.EOF if the recording is read once. A partial block at the end
+// of the recording is not returned.
+func (s *File) Read(block []byte) error {
+	if int64(len(block)) > s.file.Size {
+		return fmt.Errorf("recording must be at least %d bytes", len(block))
+	}
+	_, err := io.ReadFull(s.file, block)
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && !s.once {
+		if err = s.file.Rewind(); err == nil {
+			_, err = io.ReadFull(s.file, block)
+		}
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if err != nil || s.once {
+		return err
+	}
+	return s.pacer.wait(len(block)/s.file.Format.Size, s.meta.SampleRate)
+}
+
+// Tune has no effect, the recording has a fixed center frequency
+func (s *File) Tune(freq float64) error {
+	return nil
+}
+
+// SetGain has no effect
+func (s *File) SetGain(gain float64) error {
+	return nil
+}
+
+// Close closes the recording
+func (s *File) Close() error {
+	s.pacer.close()
+	return s.file.Close()
+}
+
+// Metadata returns the sample format, sample rate and center frequency of the recording
+func (s *File) Metadata() iq.Metadata {
+	return s.meta
+}
@@ -0,0 +1,246 @@
+package source
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/bemasher/rtltcp"
+)
+
+// Status of a source
+const (
+	StatusOK           = "ok"
+	StatusReconnecting = "reconnecting" // the connection is lost
+	StatusStopped      = "stopped"      // the source is closed or failed
+)
+
+// Connection is implemented by sources which receive the samples over a network
+// connection and reconnect when it is lost
+type Connection interface {
+	Status() string  // StatusOK, StatusReconnecting or StatusStopped
+	Reconnects() int // Number of times the connection was restored
+	ReadErrors() int // Number of times the connection was lost
+}
+
+// Delays between reconnection attempts. The delay is doubled after each attempt.
+var (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// RTLTCP receives samples from an rtl_tcp server. If the connection is lost,
+// Read reconnects and applies the sample rate, frequency correction, gain
+// and center frequency again.
+type RTLTCP struct {
+	address    string
+	opts       Options
+	sdr        rtltcp.SDR
+	mu         sync.Mutex
+	meta       iq.Metadata
+	status     string
+	reconnects int
+	readErrors int
+	closed     chan struct{}
+	once       sync.Once
+}
+
+// NewRTLTCP connects to the rtl_tcp server at 'address' and sets the sample
+// rate, gain, frequency correction and center frequency of the dongle
+func NewRTLTCP(address string, opts Options) (*RTLTCP, error) {
+	s := &RTLTCP{
+		address: address,
+		opts:    opts,
+		meta:    iq.Metadata{Format: iq.CU8.Name, SampleRate: opts.SampleRate, CenterFrequency: float64(uint32(opts.Center))},
+		status:  StatusOK,
+		closed:  make(chan struct{}),
+	}
+	s.meta.Gain, s.meta.AGC = opts.Gain, opts.AGC
+	s.meta.Start = time.Now().UTC()
+	sdr, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	err = s.apply(sdr)
+	s.mu.Unlock()
+	if err != nil {
+		sdr.Close()
+		return nil, err
+	}
+	s.sdr = sdr
+	return s, nil
+}
+
+// dial connects to the server
+func (s *RTLTCP) dial() (rtltcp.SDR, error) {
+	var sdr rtltcp.SDR
+	addr, err := net.ResolveTCPAddr("tcp", s.address)
+	if err != nil {
+		return sdr, err
+	}
+	return sdr, sdr.Connect(addr)
+}
+
+// apply sets the sample rate, frequency correction, gain and center frequency
+// of the dongle. The caller holds the mutex, so that a Tune or SetGain is not
+// lost while the settings are applied.
+func (s *RTLTCP) apply(sdr rtltcp.SDR) error {
+	err := sdr.SetSampleRate(uint32(s.meta.SampleRate))
+	if err == nil {
+		err = sdr.SetFreqCorrection(uint32(int32(s.opts.PPM)))
+	}
+	if err == nil && s.meta.AGC {
+		err = sdr.SetGainMode(true) // automatic gain
+	} else if err == nil {
+		err = setGain(sdr, s.meta.Gain)
+	}
+	if err == nil && s.meta.CenterFrequency != 0 {
+		err = sdr.SetCenterFreq(uint32(s.meta.CenterFrequency))
+	}
+	return err
+}
+
+// setGain sets the tuner gain and turns off the automatic gain
+func setGain(sdr rtltcp.SDR, gain float64) error {
+	if err := sdr.SetGainMode(false); err != nil {
+		return err
+	}
+	return sdr.SetGain(uint32(gain * 10)) // tenths of a dB
+}
+
+// Read reads a block of samples. If the connection is lost, it reconnects
+// with increasing delays until it succeeds or the source is closed.
+func (s *RTLTCP) Read(block []byte) error {
+	for {
+		_, err := io.ReadFull(s.sdr, block)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-s.closed:
+			return ErrClosed
+		default:
+		}
+		log.Printf("Lost connection to rtl_tcp at %s: %v", s.address, err)
+		s.mu.Lock()
+		s.readErrors++
+		s.mu.Unlock()
+		if err := s.reconnect(); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect replaces the lost connection. The status of a closed source is
+// left stopped.
+func (s *RTLTCP) reconnect() error {
+	s.mu.Lock()
+	if s.status == StatusStopped {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.status = StatusReconnecting
+	s.sdr.Close()
+	s.mu.Unlock()
+	backoff := minBackoff
+	for {
+		select {
+		case <-s.closed:
+			return ErrClosed
+		case <-time.After(backoff):
+		}
+		sdr, err := s.dial()
+		if err == nil {
+			s.mu.Lock()
+			if s.status == StatusStopped {
+				s.mu.Unlock()
+				sdr.Close()
+				return ErrClosed
+			}
+			if err = s.apply(sdr); err == nil {
+				s.sdr = sdr
+				s.status = StatusOK
+				s.reconnects++
+				s.mu.Unlock()
+				log.Printf("Reconnected to rtl_tcp at %s", s.address)
+				return nil
+			}
+			s.mu.Unlock()
+			sdr.Close()
+		}
+		log.Printf("Reconnecting to rtl_tcp at %s: %v", s.address, err)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Tune sets the center frequency of the dongle. While reconnecting, the
+// frequency is set when the connection is restored.
+func (s *RTLTCP) Tune(freq float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta.CenterFrequency = float64(uint32(freq))
+	if s.status != StatusOK {
+		return nil
+	}
+	return s.sdr.SetCenterFreq(uint32(freq))
+}
+
+// SetGain sets the tuner gain and turns off the automatic gain. While
+// reconnecting, the gain is set when the connection is restored.
+func (s *RTLTCP) SetGain(gain float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta.Gain = gain
+	s.meta.AGC = false
+	if s.status != StatusOK {
+		return nil
+	}
+	return setGain(s.sdr, gain)
+}
+
+// Close closes the connection, which terminates a blocked Read
+func (s *RTLTCP) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != StatusOK {
+		s.status = StatusStopped
+		return nil // already closed
+	}
+	s.status = StatusStopped
+	return s.sdr.Close()
+}
+
+// Metadata returns the settings of the dongle
+func (s *RTLTCP) Metadata() iq.Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta
+}
+
+// Status returns StatusOK, StatusReconnecting or StatusStopped
+func (s *RTLTCP) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Reconnects returns the number of times the connection was restored
+func (s *RTLTCP) Reconnects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reconnects
+}
+
+// ReadErrors returns the number of times the connection was lost
+func (s *RTLTCP) ReadErrors() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readErrors
+}
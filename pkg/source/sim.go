@@ -0,0 +1,100 @@
+package source
+
+import (
+	"sync"
+
+	"github.com/asgaut/dumpils/pkg/iq"
+	"github.com/asgaut/dumpils/pkg/siggen"
+)
+
+// Sim delivers the samples of a signal generator, or repeats a block of
+// samples set with SetSamples, in real time
+type Sim struct {
+	pacer   *pacer
+	mu      sync.Mutex
+	meta    iq.Metadata
+	gen     *siggen.Generator
+	buf     []complex64 // samples of gen
+	samples []byte
+	pos     int // next byte of samples
+}
+
+// NewSim creates a simulator which delivers zero bytes until SetSamples or SetGenerator is called
+func NewSim(opts Options) *Sim {
+	return &Sim{
+		pacer: newPacer(),
+		meta:  iq.Metadata{Format: iq.CU8.Name, SampleRate: opts.SampleRate, CenterFrequency: opts.Center, Gain: opts.Gain, AGC: opts.AGC},
+	}
+}
+
+// SetSamples sets the raw IQ samples in rtl_sdr format which are repeated by Read
+func (s *Sim) SetSamples(samples []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples[:0], samples...)
+	s.pos = 0
+	s.gen = nil
+}
+
+// SetGenerator makes Read deliver the samples synthesized by 'g' instead of the
+// samples set with SetSamples
+func (s *Sim) SetGenerator(g *siggen.Generator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen = g
+}
+
+// Read fills 'block' with the next samples. The samples are repeated without a gap.
+func (s *Sim) Read(block []byte) error {
+	s.mu.Lock()
+	if s.gen != nil {
+		if n := len(block) / iq.CU8.Size; len(s.buf) != n {
+			s.buf = make([]complex64, n)
+		}
+		s.gen.Generate(s.buf)
+		iq.EncodeCU8(block, s.buf)
+	} else if len(s.samples) == 0 {
+		for i := range block {
+			block[i] = 0
+		}
+	} else {
+		for i := 0; i < len(block); {
+			n := copy(block[i:], s.samples[s.pos:])
+			i += n
+			s.pos = (s.pos + n) % len(s.samples)
+		}
+	}
+	rate := s.meta.SampleRate
+	s.mu.Unlock()
+	return s.pacer.wait(len(block)/iq.CU8.Size, rate)
+}
+
+// Tune records the center frequency in the Metadata
+func (s *Sim) Tune(freq float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta.CenterFrequency = freq
+	return nil
+}
+
+// SetGain records the gain, and that the automatic gain is off, in the Metadata
+func (s *Sim) SetGain(gain float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta.Gain = gain
+	s.meta.AGC = false
+	return nil
+}
+
+// Close terminates a blocked Read
+func (s *Sim) Close() error {
+	s.pacer.close()
+	return nil
+}
+
+// Metadata returns the settings of the simulator
+func (s *Sim) Metadata() iq.Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta
+}
@@ -0,0 +1,155 @@
+// Package source provides blocks of raw IQ samples from rtl_tcp, IQ files and
+// a simulator to the demodulators
+package source
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/iq"
+)
+
+// SampleSource delivers raw IQ samples
+type SampleSource interface {
+	// Read fills 'block' with raw IQ samples in the format of the Metadata.
+	// It blocks until the samples are available. Files and the simulator
+	// deliver the samples in real time.
+	Read(block []byte) error
+	// Tune sets the center frequency in Hz. It has no effect on files.
+	Tune(freq float64) error
+	// SetGain sets the tuner gain in dB. It has no effect on files.
+	SetGain(gain float64) error
+	// Close stops the source. A blocked Read returns an error.
+	Close() error
+	// Metadata returns the sample format, sample rate, center frequency and gain
+	Metadata() iq.Metadata
+}
+
+// ErrClosed is returned by Read when the source is closed
+var ErrClosed = errors.New("sample source closed")
+
+// Options holds the settings of a source unless they are given by the URI
+// query or the recording
+type Options struct {
+	SampleRate float64 // Hz
+	Center     float64 // Initial center frequency in Hz, 0 to leave it unchanged
+	Gain       float64 // Tuner gain in dB
+	AGC        bool    // Automatic tuner gain instead of Gain
+	PPM        int     // Frequency correction of the dongle in ppm
+	Format     string  // Sample format of raw files, from the file extension if empty
+	Once       bool    // Read files once as fast as possible instead of repeating them in real time
+}
+
+// Open opens the source described by 'uri', which is one of
+//
+//	rtltcp://host:1234?gain=40&agc=false&ppm=0&rate=1310720&freq=109700000
+//	file:///path/to/capture.cu8?rate=1310720&format=cu8&freq=109700000
+//	sim://?rate=1310720
+//
+// where all query parameters are optional. For compatibility, host:port is
+// an rtl_tcp server, an empty string the simulator and anything else a file name.
+func Open(uri string, opts Options) (SampleSource, error) {
+	if !strings.Contains(uri, "://") {
+		switch {
+		case uri == "":
+			uri = "sim://"
+		case isHostPort(uri):
+			uri = "rtltcp://" + uri
+		default:
+			return NewFile(uri, opts)
+		}
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseQuery(u.Query(), &opts); err != nil {
+		return nil, fmt.Errorf("%s: %v", uri, err)
+	}
+	switch u.Scheme {
+	case "rtltcp":
+		return NewRTLTCP(u.Host, opts)
+	case "file":
+		return NewFile(u.Host+u.Path, opts) // file://capture.cu8 is relative
+	case "sim":
+		return NewSim(opts), nil
+	}
+	return nil, fmt.Errorf("unknown source type '%s' in '%s', must be rtltcp, file or sim", u.Scheme, uri)
+}
+
+// isHostPort reports whether 's' is an address with a numeric port
+func isHostPort(s string) bool {
+	_, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+// parseQuery sets the options given in the URI query
+func parseQuery(q url.Values, opts *Options) error {
+	for key := range q {
+		v := q.Get(key)
+		var err error
+		switch key {
+		case "rate":
+			opts.SampleRate, err = strconv.ParseFloat(v, 64)
+		case "freq":
+			opts.Center, err = strconv.ParseFloat(v, 64)
+		case "gain":
+			opts.Gain, err = strconv.ParseFloat(v, 64)
+		case "agc":
+			opts.AGC, err = strconv.ParseBool(v)
+		case "ppm":
+			opts.PPM, err = strconv.Atoi(v)
+		case "format":
+			opts.Format = v
+		case "once":
+			opts.Once, err = strconv.ParseBool(v)
+		default:
+			return fmt.Errorf("unknown parameter '%s'", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s'", key, v)
+		}
+	}
+	return nil
+}
+
+// pacer delivers blocks of samples in real time
+type pacer struct {
+	next   time.Time
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPacer() *pacer {
+	return &pacer{closed: make(chan struct{})}
+}
+
+// wait blocks until 'samples' samples at 'rate' samples/s after the previous call
+func (p *pacer) wait(samples int, rate float64) error {
+	now := time.Now()
+	if p.next.IsZero() || p.next.Before(now.Add(-time.Second)) {
+		p.next = now // start over if the reader is too slow
+	}
+	p.next = p.next.Add(time.Duration(float64(samples) / rate * float64(time.Second)))
+	select {
+	case <-p.closed:
+		return ErrClosed
+	case <-time.After(time.Until(p.next)):
+		return nil
+	}
+}
+
+// close terminates a blocked wait
+func (p *pacer) close() {
+	p.once.Do(func() { close(p.closed) })
+}
@@ -0,0 +1,291 @@
+package source
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asgaut/dumpils/pkg/siggen"
+)
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "capture.cs16le")
+	if err := ioutil.WriteFile(name, make([]byte, 4000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{SampleRate: 1e6, Center: 109.7e6}
+	tests := []struct {
+		uri    string
+		format string
+		rate   float64
+		center float64
+	}{
+		{"sim://", "cu8", 1e6, 109.7e6},
+		{"", "cu8", 1e6, 109.7e6},
+		{"sim://?rate=2048000&freq=110e6", "cu8", 2.048e6, 110e6},
+		{name, "cs16le", 1e6, 109.7e6},
+		{"file://" + filepath.ToSlash(name) + "?rate=250000&format=cu8", "cu8", 250e3, 109.7e6},
+	}
+	for _, tc := range tests {
+		s, err := Open(tc.uri, opts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.uri, err)
+			continue
+		}
+		m := s.Metadata()
+		if m.Format != tc.format || m.SampleRate != tc.rate || m.CenterFrequency != tc.center {
+			t.Errorf("%s: %+v, want %s at %.0f S/s and %.0f Hz", tc.uri, m, tc.format, tc.rate, tc.center)
+		}
+		s.Close()
+	}
+
+	for _, uri := range []string{"udp://localhost:1234", "sim://?rate=fast", "sim://?bandwidth=1", filepath.Join(dir, "missing.cu8")} {
+		if s, err := Open(uri, opts); err == nil {
+			s.Close()
+			t.Errorf("%s: no error", uri)
+		}
+	}
+	for s, want := range map[string]bool{"127.0.0.1:1234": true, "localhost:1234": true, "[::1]:1234": true,
+		"capture.cu8": false, `C:\capture.cu8`: false, "host:name": false} {
+		if isHostPort(s) != want {
+			t.Errorf("isHostPort(%s) is %v", s, !want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "capture.cu8")
+	data := make([]byte, 2500)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read once: two whole blocks, the partial block is not returned
+	s, err := NewFile(name, Options{SampleRate: 10e3, Once: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := make([]byte, 1000)
+	for i := 0; i < 2; i++ {
+		if err := s.Read(block); err != nil || !bytes.Equal(block, data[i*1000:(i+1)*1000]) {
+			t.Fatalf("block %d: %v", i, err)
+		}
+	}
+	if err := s.Read(block); err != io.EOF {
+		t.Errorf("got %v at the end of the file, want EOF", err)
+	}
+	s.Close()
+
+	// Repeated in real time: 500 samples at 10 kS/s take 50 ms
+	s, err = NewFile(name, Options{SampleRate: 10e3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := s.Read(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > time.Second {
+		t.Errorf("4 blocks took %v, want 200 ms", elapsed)
+	}
+	if !bytes.Equal(block, data[1000:2000]) {
+		t.Errorf("the file is not repeated from the start")
+	}
+
+	// Close terminates a blocked Read
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.Close()
+	}()
+	s.pacer.next = time.Now().Add(time.Hour)
+	if err := s.Read(block); err == nil {
+		t.Errorf("Read returned no error after Close")
+	}
+}
+
+func TestSim(t *testing.T) {
+	s := NewSim(Options{SampleRate: 1e6, AGC: true})
+	defer s.Close()
+	block := make([]byte, 10)
+	if err := s.Read(block); err != nil || !bytes.Equal(block, make([]byte, 10)) {
+		t.Errorf("got %v %v, want zeros", block, err)
+	}
+	s.SetSamples([]byte{1, 2, 3, 4})
+	if err := s.Read(block); err != nil || !bytes.Equal(block, []byte{1, 2, 3, 4, 1, 2, 3, 4, 1, 2}) {
+		t.Errorf("got %v %v, want the samples repeated", block, err)
+	}
+	if err := s.Read(block); err != nil || !bytes.Equal(block, []byte{3, 4, 1, 2, 3, 4, 1, 2, 3, 4}) {
+		t.Errorf("got %v %v, want the samples continued", block, err)
+	}
+	// An unmodulated carrier at the center frequency
+	g, err := siggen.New(1e6, 0, siggen.Params{Carrier: siggen.Carrier{RF: -6.0206}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGenerator(g)
+	if err := s.Read(block); err != nil || !bytes.Equal(block, bytes.Repeat([]byte{191, 128}, 5)) {
+		t.Errorf("got %v %v, want the generated samples", block, err)
+	}
+	if err := s.Tune(110.1e6); err != nil || s.Metadata().CenterFrequency != 110.1e6 {
+		t.Errorf("center frequency %.0f Hz, want 110100000 Hz", s.Metadata().CenterFrequency)
+	}
+	if m := s.Metadata(); !m.AGC {
+		t.Errorf("metadata %+v, want automatic gain", m)
+	}
+	if err := s.SetGain(20); err != nil || s.Metadata().Gain != 20 || s.Metadata().AGC {
+		t.Errorf("metadata %+v, want a tuner gain of 20 dB", s.Metadata())
+	}
+}
+
+// rtlServer accepts connections like rtl_tcp and sends 'n' bytes of samples on
+// each connection before ending the stream. The commands received are sent to 'commands'.
+func rtlServer(t *testing.T, n int, commands chan<- [5]byte) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var cmd [5]byte
+				for {
+					if _, err := io.ReadFull(conn, cmd[:]); err != nil {
+						return
+					}
+					commands <- cmd
+				}
+			}()
+			conn.Write([]byte{'R', 'T', 'L', '0', 0, 0, 0, 5, 0, 0, 0, 29})
+			conn.Write(bytes.Repeat([]byte{127}, n))
+			conn.(*net.TCPConn).CloseWrite()
+		}
+	}()
+	return l
+}
+
+func TestReconnect(t *testing.T) {
+	minBackoff = 10 * time.Millisecond
+	commands := make(chan [5]byte, 100)
+	l := rtlServer(t, 3000, commands)
+	defer l.Close()
+
+	s, err := Open("rtltcp://"+l.Addr().String(), Options{SampleRate: 1e6, Gain: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Tune(110.1e6); err != nil {
+		t.Fatal(err)
+	}
+	block := make([]byte, 1000)
+	for i := 0; i < 5; i++ { // the connection is lost after 3 blocks
+		if err := s.Read(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := s.(Connection)
+	if c.Status() != StatusOK || c.Reconnects() != 1 || c.ReadErrors() != 1 {
+		t.Errorf("status %s after %d reconnects and %d read errors, want ok after 1", c.Status(), c.Reconnects(), c.ReadErrors())
+	}
+
+	// The settings are applied on both connections
+	want := map[[5]byte]int{
+		{2, 0, 0x0f, 0x42, 0x40}:    2, // sample rate
+		{3, 0, 0, 0, 1}:             2, // manual gain
+		{4, 0, 0, 0x01, 0x90}:       2, // gain in tenths of a dB
+		{1, 0x06, 0x8f, 0xfe, 0x20}: 2, // center frequency
+	}
+	got := map[[5]byte]int{}
+	timeout := time.After(time.Second)
+	for len(got) < len(want) || got[[5]byte{1, 0x06, 0x8f, 0xfe, 0x20}] < 2 {
+		select {
+		case cmd := <-commands:
+			got[cmd]++
+		case <-timeout:
+			t.Fatalf("got commands %v, want %v", got, want)
+		}
+	}
+	for cmd, n := range want {
+		if got[cmd] != n {
+			t.Errorf("command %v sent %d times, want %d", cmd, got[cmd], n)
+		}
+	}
+}
+
+// TestWhileReconnecting tunes and closes the source while it reconnects
+func TestWhileReconnecting(t *testing.T) {
+	minBackoff = 100 * time.Millisecond
+	commands := make(chan [5]byte, 100)
+	l := rtlServer(t, 1000, commands)
+	defer l.Close()
+
+	s, err := Open("rtltcp://"+l.Addr().String(), Options{SampleRate: 1e6, Gain: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.(Connection)
+	block := make([]byte, 1000)
+	read := func() <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- s.Read(block) }()
+		for start := time.Now(); c.Status() != StatusReconnecting; time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("status %s, want reconnecting", c.Status())
+			}
+		}
+		return done
+	}
+	if err := s.Read(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The frequency is set on the new connection
+	done := read()
+	if err := s.Tune(110.1e6); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(time.Second)
+	for cmd := [5]byte{}; cmd != [5]byte{1, 0x06, 0x8f, 0xfe, 0x20}; {
+		select {
+		case cmd = <-commands:
+		case <-timeout:
+			t.Fatal("center frequency not set after reconnecting")
+		}
+	}
+
+	// A source closed while reconnecting stays stopped
+	done = read()
+	s.Close()
+	if err := <-done; err != ErrClosed || c.Status() != StatusStopped {
+		t.Errorf("got %v and status %s, want ErrClosed and stopped", err, c.Status())
+	}
+}
@@ -0,0 +1,213 @@
+// Package vor implements a receiver for VHF omnidirectional range (VOR) beacons.
+//
+// The carrier is amplitude modulated by the 30 Hz variable signal, whose phase
+// depends on the direction from the beacon, and by a 9960 Hz subcarrier which
+// is frequency modulated by the 30 Hz reference signal. The radial is the
+// phase lag of the variable signal relative to the reference signal.
+// The beacon is identified by a 1020 Hz Morse code tone.
+package vor
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/asgaut/dumpils/pkg/demod2"
+	"github.com/asgaut/dumpils/pkg/dsp"
+	"github.com/asgaut/dumpils/pkg/ident"
+	"github.com/asgaut/dumpils/pkg/ils"
+	"github.com/ktye/fft"
+)
+
+// Frequencies of the VOR modulation in Hz
+const (
+	Tone30     = 30.0
+	Subcarrier = 9960.0
+)
+
+const (
+	subBandwidth = 5e3 // bandwidth of the subcarrier filter in Hz
+	subFactor    = 4   // decimation of the subcarrier before the FM discriminator
+	subLength    = 255 // taps of the subcarrier filter
+)
+
+// Meas holds the VOR measurements
+type Meas struct {
+	RF        float32     `json:"rf"`        // Carrier level in dBFS
+	Bearing   float32     `json:"bearing"`   // Radial in degrees from the phase of the 30 Hz variable signal relative to the reference
+	Mod30     float32     `json:"mod30"`     // 30 Hz variable signal AM depth in percent
+	Mod9960   float32     `json:"mod9960"`   // 9960 Hz subcarrier AM depth in percent
+	Deviation float32     `json:"deviation"` // Frequency deviation of the subcarrier by the 30 Hz reference in Hz
+	Ident     ident.Ident `json:"ident"`
+}
+
+// Demodulator contains preallocated buffers and state for the VOR receiver
+type Demodulator struct {
+	n          int // input samples per Process call
+	fs         float64
+	dec        *demod2.Decimator
+	fft1, fft2 fft.FFT
+	IQ         []complex128 // input samples of the latest Process call
+	FFT1       []complex128
+	LF         []complex128 // decimated channel samples of the latest Process call
+	Envelope   []complex128 // analysis window of the demodulated AM signal
+	FFT2       []complex128
+	Reference  []complex128 // analysis window of the FM demodulated subcarrier in Hz
+	sub        []complex128 // FM demodulated subcarrier of the latest Process call
+	window     []float64
+	refWindow  []float64
+	bin30      float64
+	refBin30   float64
+	rot, step  complex128 // NCO mixing the subcarrier down to zero frequency
+	taps       []float64
+	history    []complex128 // subcarrier filter delay line, twice the filter length
+	historyPos int
+	subCount   int // envelope samples since the latest subcarrier filter output
+	prev       complex128
+	delay      float64 // delay of the reference signal in seconds
+	ident      *ident.Decoder
+	meas       Meas
+}
+
+// NewDemodulator creates a VOR Demodulator.
+// The returned error is a *ils.ConfigError if the Config is invalid.
+func NewDemodulator(cfg ils.Config) (*Demodulator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	dec, err := demod2.NewDecimator(cfg.SampleRate, cfg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	fs := dec.OutputRate()
+	numSamples := cfg.BlockSize()
+	windowSize := int(math.Round(fs * cfg.Period().Seconds()))
+	refSize := windowSize / subFactor
+	f1, err := fft.New(dsp.NextPow2(numSamples))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT1: %v", err)
+	}
+	f2, err := fft.New(dsp.NextPow2(windowSize))
+	if err != nil {
+		return nil, fmt.Errorf("error init FFT2: %v", err)
+	}
+	return &Demodulator{
+		n:         numSamples,
+		fs:        fs,
+		dec:       dec,
+		fft1:      f1,
+		fft2:      f2,
+		IQ:        make([]complex128, numSamples),
+		FFT1:      make([]complex128, f1.N),
+		LF:        make([]complex128, numSamples/dec.Factor()+1),
+		Envelope:  make([]complex128, windowSize),
+		FFT2:      make([]complex128, f2.N),
+		Reference: make([]complex128, refSize),
+		sub:       make([]complex128, 0, (numSamples/dec.Factor()+1)/subFactor+1),
+		window:    dsp.Hann(windowSize),
+		refWindow: dsp.Hann(refSize),
+		bin30:     Tone30 * float64(windowSize) / fs,
+		refBin30:  Tone30 * float64(refSize) * subFactor / fs,
+		rot:       1,
+		step:      cmplx.Exp(complex(0, -2*math.Pi*Subcarrier/fs)),
+		taps:      dsp.LowpassTaps(subLength, subBandwidth/2/fs),
+		history:   make([]complex128, 2*subLength),
+		// Group delay of the subcarrier filter and half a sample from the FM discriminator
+		delay: (float64(subLength-1)/2 + subFactor/2.0) / fs,
+		ident: ident.NewDecoder(fs),
+	}, nil
+}
+
+// Spectrum1 returns the amplitude spectrum of the input samples
+func (d *Demodulator) Spectrum1() []float32 {
+	return dsp.Spectrum(d.fft1, d.IQ, d.FFT1)
+}
+
+// Spectrum2 returns the amplitude spectrum of the demodulated AM signal
+func (d *Demodulator) Spectrum2() []float32 {
+	return dsp.Spectrum(d.fft2, d.Envelope, d.FFT2)
+}
+
+// Process input samples and calculate the VOR measurements.
+// The 'iq' slice holds the samples following the previous call to Process.
+func (d *Demodulator) Process(iq []complex64) (Meas, error) {
+	if len(iq) != d.n {
+		return d.meas, &ils.InputLengthError{Got: len(iq), Want: d.n}
+	}
+	dsp.ToComplex128(iq, d.IQ)
+	n := d.dec.Process(d.IQ, d.LF)
+	lf := d.LF[:n]
+	if n > len(d.Envelope) {
+		lf = lf[n-len(d.Envelope):]
+	}
+	copy(d.Envelope, d.Envelope[len(lf):])
+	envelope := d.Envelope[len(d.Envelope)-len(lf):]
+	for i, v := range lf {
+		envelope[i] = complex(cmplx.Abs(v), 0)
+	}
+	d.ident.Process(envelope)
+	subLevel := d.subcarrier(envelope)
+
+	// The phases of the 30 Hz signals are both referred to the time of the latest envelope sample
+	carrier := dsp.DFT(d.Envelope, d.window, 0)
+	variable := dsp.DFT(d.Envelope, d.window, d.bin30)
+	reference := dsp.DFT(d.Reference, d.refWindow, d.refBin30)
+	lag := float64(len(d.Envelope)-1) / d.fs
+	refLag := float64((len(d.Reference)-1)*subFactor+d.subCount)/d.fs + d.delay
+	phase := cmplx.Phase(reference) - cmplx.Phase(variable) + 2*math.Pi*Tone30*(refLag-lag)
+	bearing := math.Mod(phase*180/math.Pi, 360)
+	if bearing < 0 {
+		bearing += 360
+	}
+
+	d.meas.Bearing = float32(bearing)
+	d.meas.Mod30 = ils.Depth(cmplx.Abs(variable), cmplx.Abs(carrier))
+	d.meas.Deviation = float32(4 * cmplx.Abs(reference) / float64(len(d.Reference))) // Hann window sum is n/2
+	level := cmplx.Abs(carrier) / (0.5 * float64(len(d.Envelope)))                   // Coherent gain of the Hann window is 0.5
+	d.meas.Mod9960 = ils.Depth(subLevel/d.dec.Gain(Subcarrier), level)
+	d.meas.Ident = d.ident.Ident()
+	d.meas.RF = ils.DBFS(level) // Carrier power in dBFS
+	return d.meas, nil
+}
+
+// subcarrier mixes the 9960 Hz subcarrier of the envelope samples down to zero
+// frequency, filters and decimates it and slides the FM demodulated samples into
+// the Reference window. It returns the mean amplitude of the subcarrier.
+func (d *Demodulator) subcarrier(envelope []complex128) float64 {
+	sub := d.sub[:0]
+	var level float64
+	for _, x := range envelope {
+		// The delay line is stored twice so the taps can be applied to a contiguous slice
+		y := x * d.rot
+		d.rot *= d.step
+		d.history[d.historyPos] = y
+		d.history[d.historyPos+subLength] = y
+		d.historyPos = (d.historyPos + 1) % subLength
+		d.subCount++
+		if d.subCount < subFactor {
+			continue
+		}
+		d.subCount = 0
+		var z complex128
+		h := d.history[d.historyPos : d.historyPos+subLength]
+		for i, t := range d.taps {
+			z += h[i] * complex(t, 0)
+		}
+		// FM discriminator, the phase step between samples gives the frequency
+		f := cmplx.Phase(z*cmplx.Conj(d.prev)) * d.fs / subFactor / (2 * math.Pi)
+		d.prev = z
+		level += cmplx.Abs(z)
+		sub = append(sub, complex(f, 0))
+	}
+	d.rot /= complex(cmplx.Abs(d.rot), 0) // avoid accumulating rounding errors
+	if len(sub) == 0 {
+		return 0
+	}
+	level /= float64(len(sub))
+	if len(sub) > len(d.Reference) {
+		sub = sub[len(sub)-len(d.Reference):]
+	}
+	copy(d.Reference, d.Reference[len(sub):])
+	copy(d.Reference[len(d.Reference)-len(sub):], sub)
+	return level
+}
@@ -0,0 +1,58 @@
+package vor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/asgaut/dumpils/pkg/ils"
+)
+
+// generate returns 'n' samples of a VOR signal on radial 'bearing' at 'offset' Hz starting at time 'start'
+func generate(fs, offset, bearing, start float64, n int) []complex64 {
+	iq := make([]complex64, n)
+	for i := range iq {
+		t := start + float64(i)/fs
+		variable := 0.3 * math.Cos(2*math.Pi*Tone30*t-bearing*math.Pi/180)
+		subcarrier := 0.3 * math.Cos(2*math.Pi*Subcarrier*t+480/Tone30*math.Sin(2*math.Pi*Tone30*t))
+		a := 0.4 * (1 + variable + subcarrier)
+		ph := 2 * math.Pi * offset * t
+		iq[i] = complex64(complex(a*math.Cos(ph), a*math.Sin(ph)))
+	}
+	return iq
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		fs, offset, bearing float64
+	}{
+		{10.0 * float64(1<<17), 200e3, 0},
+		{10.0 * float64(1<<17), 200e3, 45},
+		{1.024e6, 250e3, 137.5},
+		{2.048e6, -300e3, 270},
+		{250e3, 100e3, 359},
+	}
+	for _, tc := range tests {
+		cfg := ils.Config{SampleRate: tc.fs, Offset: tc.offset}
+		d, err := NewDemodulator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m Meas
+		n := cfg.BlockSize()
+		for block := 0; block < 5; block++ {
+			m, err = d.Process(generate(tc.fs, tc.offset, tc.bearing, float64(block*n)/tc.fs, n))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Logf("fs=%.0f offset=%.0f: RF:%.2f dBFS; %+v", tc.fs, tc.offset, m.RF, m)
+		diff := math.Mod(float64(m.Bearing)-tc.bearing+540, 360) - 180
+		if math.Abs(diff) > 0.5 {
+			t.Errorf("fs=%.0f offset=%.0f: bearing %.2f°, want %.2f°", tc.fs, tc.offset, m.Bearing, tc.bearing)
+		}
+		if math.Abs(float64(m.Mod30)-30) > 0.5 || math.Abs(float64(m.Mod9960)-30) > 1 || math.Abs(float64(m.Deviation)-480) > 5 {
+			t.Errorf("fs=%.0f offset=%.0f: 30 Hz %.2f%%, 9960 Hz %.2f%%, deviation %.1f Hz, want 30%%, 30%% and 480 Hz",
+				tc.fs, tc.offset, m.Mod30, m.Mod9960, m.Deviation)
+		}
+	}
+}
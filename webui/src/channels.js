@@ -1,89 +0,0 @@
-// Source: https://wiki.radioreference.com/index.php/Instrument_Landing_System_(ILS)_Frequencies
-
-export default [
-  { name: "17X", vor: 108 },
-  { name: "17Y", vor: 108.05 },
-  { name: "18X", loc: 108.1, gp: 334.7 },
-  { name: "18Y", loc: 108.15, gp: 334.55 },
-  { name: "19X", vor: 108.2 },
-  { name: "19Y", vor: 108.25 },
-  { name: "20X", loc: 108.3, gp: 334.1 },
-  { name: "20Y", loc: 108.35, gp: 333.95 },
-  { name: "21X", vor: 108.4 },
-  { name: "21Y", vor: 108.45 },
-  { name: "22X", loc: 108.5, gp: 329.9 },
-  { name: "22Y", loc: 108.55, gp: 329.75 },
-  { name: "23X", vor: 108.6 },
-  { name: "23Y", vor: 108.65 },
-  { name: "24X", loc: 108.7, gp: 330.5 },
-  { name: "24Y", loc: 108.75, gp: 330.35 },
-  { name: "25X", vor: 108.8 },
-  { name: "25Y", vor: 108.85 },
-  { name: "26X", loc: 108.9, gp: 329.3 },
-  { name: "26Y", loc: 108.95, gp: 329.15 },
-  { name: "27X", vor: 109 },
-  { name: "27Y", vor: 109.05 },
-  { name: "28X", loc: 109.1, gp: 331.4 },
-  { name: "28Y", loc: 109.15, gp: 331.25 },
-  { name: "29X", vor: 109.2 },
-  { name: "29Y", vor: 109.25 },
-  { name: "30X", loc: 109.3, gp: 332 },
-  { name: "30Y", loc: 109.35, gp: 331.85 },
-  { name: "31X", vor: 109.4 },
-  { name: "31Y", vor: 109.45 },
-  { name: "32X", loc: 109.5, gp: 332.6 },
-  { name: "32Y", loc: 109.55, gp: 332.45 },
-  { name: "33X", vor: 109.6 },
-  { name: "33Y", vor: 109.65 },
-  { name: "34X", loc: 109.7, gp: 333.2 },
-  { name: "34Y", loc: 109.75, gp: 333.05 },
-  { name: "35X", vor: 109.8 },
-  { name: "35Y", vor: 109.85 },
-  { name: "36X", loc: 109.9, gp: 333.8 },
-  { name: "36Y", loc: 109.95, gp: 333.65 },
-  { name: "37X", vor: 110 },
-  { name: "37Y", vor: 110.05 },
-  { name: "38X", loc: 110.1, gp: 334.4 },
-  { name: "38Y", loc: 110.15, gp: 334.25 },
-  { name: "39X", vor: 110.2 },
-  { name: "39Y", vor: 110.25 },
-  { name: "40X", loc: 110.3, gp: 335 },
-  { name: "40Y", loc: 110.35, gp: 334.85 },
-  { name: "41X", vor: 110.4 },
-  { name: "41Y", vor: 110.45 },
-  { name: "42X", loc: 110.5, gp: 329.6 },
-  { name: "42Y", loc: 110.55, gp: 329.45 },
-  { name: "43X", vor: 110.6 },
-  { name: "43Y", vor: 110.65 },
-  { name: "44X", loc: 110.7, gp: 330.2 },
-  { name: "44Y", loc: 110.75, gp: 330.05 },
-  { name: "45X", vor: 110.8 },
-  { name: "45Y", vor: 110.85 },
-  { name: "46X", loc: 110.9, gp: 330.8 },
-  { name: "46Y", loc: 110.95, gp: 330.65 },
-  { name: "47X", vor: 111 },
-  { name: "47Y", vor: 111.05 },
-  { name: "48X", loc: 111.1, gp: 331.7 },
-  { name: "48Y", loc: 111.15, gp: 331.55 },
-  { name: "49X", vor: 111.2 },
-  { name: "49Y", vor: 111.25 },
-  { name: "50X", loc: 111.3, gp: 332.3 },
-  { name: "50Y", loc: 111.35, gp: 332.15 },
-  { name: "51X", vor: 111.4 },
-  { name: "51Y", vor: 111.45 },
-  { name: "52X", loc: 111.5, gp: 332.9 },
-  { name: "52Y", loc: 111.55, gp: 332.75 },
-  { name: "53X", vor: 111.6 },
-  { name: "53Y", vor: 111.65 },
-  { name: "54X", loc: 111.7, gp: 333.5 },
-  { name: "54Y", loc: 111.75, gp: 333.35 },
-  { name: "55X", vor: 111.8 },
-  { name: "55Y", vor: 111.85 },
-  { name: "56X", loc: 111.9, gp: 331.1 },
-  { name: "56Y", loc: 111.95, gp: 330.95 },
-  { name: "57Y", vor: 112.05 },
-  { name: "58X", vor: 112.1 },
-  { name: "58Y", vor: 112.15 },
-  { name: "59X", vor: 112.2 },
-  { name: "59Y", vor: 112.25 }
-];